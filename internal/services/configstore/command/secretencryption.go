@@ -0,0 +1,195 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+
+	"github.com/sorintlab/errors"
+
+	"agola.io/agola/internal/services/configstore/kms"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+// encryptSecretData envelope-encrypts data: a fresh, random DEK encrypts the
+// JSON-marshaled data with AES-256-GCM, and kmsProvider wraps that DEK with
+// its current KEK. The plaintext DEK is discarded as soon as this returns;
+// only kmsProvider.UnwrapDEK can ever recover it, which the runservice
+// executor calls at task materialization time and RotateKEK calls only to
+// re-wrap the DEK.
+func encryptSecretData(ctx context.Context, kmsProvider kms.KMSProvider, data map[string]string) (*cstypes.EncryptedSecretData, error) {
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal secret data")
+	}
+
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, errors.Wrapf(err, "failed to generate dek")
+	}
+	defer zero(dek)
+
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to init aes cipher")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to init gcm")
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrapf(err, "failed to generate nonce")
+	}
+	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
+
+	wrappedDEK, kekID, err := kmsProvider.WrapDEK(ctx, dek)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to wrap dek")
+	}
+
+	return &cstypes.EncryptedSecretData{
+		Ciphertext: ciphertext,
+		WrappedDEK: wrappedDEK,
+		KEKID:      kekID,
+		Alg:        cstypes.EncryptionAlgAES256GCM,
+	}, nil
+}
+
+// RotateKEK re-wraps enc's DEK under newKMSProvider's current KEK. It only
+// ever has oldKMSProvider unwrap the DEK and newKMSProvider wrap it again;
+// enc.Ciphertext, and therefore the secret's plaintext data, is never
+// touched or decrypted.
+func RotateKEK(ctx context.Context, oldKMSProvider, newKMSProvider kms.KMSProvider, enc *cstypes.EncryptedSecretData) (*cstypes.EncryptedSecretData, error) {
+	if enc.Alg != cstypes.EncryptionAlgAES256GCM {
+		return nil, errors.Errorf("unsupported encryption alg %q", enc.Alg)
+	}
+
+	dek, err := oldKMSProvider.UnwrapDEK(ctx, enc.WrappedDEK, enc.KEKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to unwrap dek with old kek")
+	}
+	defer zero(dek)
+
+	wrappedDEK, kekID, err := newKMSProvider.WrapDEK(ctx, dek)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to wrap dek with new kek")
+	}
+
+	return &cstypes.EncryptedSecretData{
+		Ciphertext: enc.Ciphertext,
+		WrappedDEK: wrappedDEK,
+		KEKID:      kekID,
+		Alg:        enc.Alg,
+	}, nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// EncryptSecretData envelope-encrypts data with the configured KMS provider
+// and keeps the result, keyed by key, so a later RotateKEK can find and
+// re-wrap it. It's called from the secret create/update flow before the
+// create/update request is even sent to configstore, so the request (and
+// the record it persists) carries Encrypted instead of plaintext Data; key
+// identifies the secret (its parent/name path, since a not-yet-created
+// secret has no ID yet) rather than anything configstore-assigned.
+//
+// oldKey, if non-empty, is the key this same secret was previously
+// encrypted under (e.g. its path before a rename); its entry is dropped once
+// key's entry is written, so renaming a secret doesn't leave an orphaned,
+// permanently stale entry behind for RotateKEK to keep rewrapping forever.
+func (c *CommandHandler) EncryptSecretData(ctx context.Context, key, oldKey string, data map[string]string) (*cstypes.EncryptedSecretData, error) {
+	// The lock is held across the encryption too, so a concurrent RotateKEK
+	// can't swap c.kmsProvider between the wrap and the store below.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.kmsProvider == nil {
+		return nil, errors.Errorf("no kms provider configured")
+	}
+
+	enc, err := encryptSecretData(ctx, c.kmsProvider, data)
+	if err != nil {
+		return nil, err
+	}
+
+	c.encryptedSecrets[key] = enc
+	if oldKey != "" && oldKey != key {
+		delete(c.encryptedSecrets, oldKey)
+	}
+
+	return enc, nil
+}
+
+// SetNextKMSProvider stages newKMSProvider as the target of the next
+// RotateKEK call, e.g. once an operator has deployed a new KEK (a new local
+// key file, a new Vault Transit key version) and wants every secret
+// re-wrapped under it.
+func (c *CommandHandler) SetNextKMSProvider(newKMSProvider kms.KMSProvider) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextKMSProvider = newKMSProvider
+}
+
+// RotateKEK re-wraps every known secret's DEK under the KMS provider staged
+// with SetNextKMSProvider, then makes that provider the current one. It
+// returns how many secrets were rotated.
+//
+// The whole rotation runs under a single lock acquisition: releasing and
+// re-acquiring the lock per secret would let EncryptSecretData slip a new,
+// still-oldKMSProvider-wrapped entry into c.encryptedSecrets after it had
+// already been snapshotted, leaving that secret permanently un-rotatable
+// once c.kmsProvider is swapped below.
+func (c *CommandHandler) RotateKEK(ctx context.Context) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	oldKMSProvider := c.kmsProvider
+	newKMSProvider := c.nextKMSProvider
+	if newKMSProvider == nil {
+		return 0, errors.Errorf("no new kms provider staged for rotation")
+	}
+
+	rotated := 0
+	for id, enc := range c.encryptedSecrets {
+		if enc.KEKID == newKMSProvider.KEKID() {
+			continue
+		}
+
+		rewrapped, err := RotateKEK(ctx, oldKMSProvider, newKMSProvider, enc)
+		if err != nil {
+			return rotated, errors.Wrapf(err, "failed to rotate kek for secret %q", id)
+		}
+
+		c.encryptedSecrets[id] = rewrapped
+		rotated++
+	}
+
+	c.kmsProvider = newKMSProvider
+	c.nextKMSProvider = nil
+
+	return rotated, nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"agola.io/agola/internal/services/configstore/kms"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+func newTestLocalKMSProvider(t *testing.T) kms.KMSProvider {
+	t.Helper()
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate test kms key: %v", err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "kek")
+	if err := os.WriteFile(keyFile, key, 0o600); err != nil {
+		t.Fatalf("failed to write test kms key file: %v", err)
+	}
+
+	p, err := kms.NewKMSProvider(&kms.Config{Type: kms.KMSProviderTypeLocal, Local: &kms.LocalConfig{KeyFile: keyFile}})
+	if err != nil {
+		t.Fatalf("NewKMSProvider() error = %v", err)
+	}
+
+	return p
+}
+
+// testDecryptSecretData mirrors the runservice executor's decryptSecretData:
+// it's the only way to independently check EncryptSecretData's output here,
+// since that function lives in a different package and is unexported there.
+func testDecryptSecretData(t *testing.T, ctx context.Context, kmsProvider kms.KMSProvider, enc *cstypes.EncryptedSecretData) map[string]string {
+	t.Helper()
+
+	dek, err := kmsProvider.UnwrapDEK(ctx, enc.WrappedDEK, enc.KEKID)
+	if err != nil {
+		t.Fatalf("UnwrapDEK() error = %v", err)
+	}
+
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		t.Fatalf("aes.NewCipher() error = %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("cipher.NewGCM() error = %v", err)
+	}
+
+	nonceSize := gcm.NonceSize()
+	nonce, ciphertext := enc.Ciphertext[:nonceSize], enc.Ciphertext[nonceSize:]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("gcm.Open() error = %v", err)
+	}
+
+	var data map[string]string
+	if err := json.Unmarshal(plaintext, &data); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	return data
+}
+
+func TestEncryptSecretDataRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	provider := newTestLocalKMSProvider(t)
+	ch, err := NewCommandHandler(provider, "")
+	if err != nil {
+		t.Fatalf("NewCommandHandler() error = %v", err)
+	}
+
+	data := map[string]string{"username": "admin", "password": "s3cr3t"}
+
+	enc, err := ch.EncryptSecretData(ctx, "secret1", "", data)
+	if err != nil {
+		t.Fatalf("EncryptSecretData() error = %v", err)
+	}
+	if len(enc.Ciphertext) == 0 || len(enc.WrappedDEK) == 0 {
+		t.Fatalf("EncryptSecretData() returned empty ciphertext/wrapped dek")
+	}
+	if enc.KEKID != provider.KEKID() {
+		t.Fatalf("EncryptSecretData() KEKID = %q, want %q", enc.KEKID, provider.KEKID())
+	}
+
+	got := testDecryptSecretData(t, ctx, provider, enc)
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("decrypted data = %v, want %v", got, data)
+	}
+}
+
+func TestRotateKEK(t *testing.T) {
+	ctx := context.Background()
+	oldProvider := newTestLocalKMSProvider(t)
+	ch, err := NewCommandHandler(oldProvider, "")
+	if err != nil {
+		t.Fatalf("NewCommandHandler() error = %v", err)
+	}
+
+	data := map[string]string{"token": "abc123"}
+	enc, err := ch.EncryptSecretData(ctx, "secret1", "", data)
+	if err != nil {
+		t.Fatalf("EncryptSecretData() error = %v", err)
+	}
+
+	newProvider := newTestLocalKMSProvider(t)
+	ch.SetNextKMSProvider(newProvider)
+
+	rotated, err := ch.RotateKEK(ctx)
+	if err != nil {
+		t.Fatalf("RotateKEK() error = %v", err)
+	}
+	if rotated != 1 {
+		t.Errorf("RotateKEK() rotated = %d, want 1", rotated)
+	}
+
+	ch.mu.Lock()
+	rewrapped := ch.encryptedSecrets["secret1"]
+	ch.mu.Unlock()
+
+	if rewrapped.KEKID == enc.KEKID {
+		t.Errorf("RotateKEK() left KEKID unchanged (%q)", rewrapped.KEKID)
+	}
+	if rewrapped.KEKID != newProvider.KEKID() {
+		t.Errorf("after RotateKEK() KEKID = %q, want %q", rewrapped.KEKID, newProvider.KEKID())
+	}
+
+	got := testDecryptSecretData(t, ctx, newProvider, rewrapped)
+	if !reflect.DeepEqual(got, data) {
+		t.Errorf("decrypted data after rotation = %v, want %v", got, data)
+	}
+
+	// A second RotateKEK with nothing staged must fail rather than silently
+	// no-op, so callers can tell a rotation didn't happen.
+	if _, err := ch.RotateKEK(ctx); err == nil {
+		t.Errorf("RotateKEK() with no staged provider: expected error, got nil")
+	}
+}
+
+// TestEncryptSecretDataRenameMigratesEntry checks that re-encrypting under a
+// new key with oldKey set drops the old key's entry instead of leaving it
+// behind for RotateKEK to keep rewrapping forever after a secret is renamed.
+func TestEncryptSecretDataRenameMigratesEntry(t *testing.T) {
+	ctx := context.Background()
+	provider := newTestLocalKMSProvider(t)
+	ch, err := NewCommandHandler(provider, "")
+	if err != nil {
+		t.Fatalf("NewCommandHandler() error = %v", err)
+	}
+
+	data := map[string]string{"username": "admin"}
+	if _, err := ch.EncryptSecretData(ctx, "project/p1/foo", "", data); err != nil {
+		t.Fatalf("EncryptSecretData() error = %v", err)
+	}
+
+	if _, err := ch.EncryptSecretData(ctx, "project/p1/bar", "project/p1/foo", data); err != nil {
+		t.Fatalf("EncryptSecretData() error = %v", err)
+	}
+
+	ch.mu.Lock()
+	_, oldStillPresent := ch.encryptedSecrets["project/p1/foo"]
+	_, newPresent := ch.encryptedSecrets["project/p1/bar"]
+	ch.mu.Unlock()
+
+	if oldStillPresent {
+		t.Errorf("old key entry still present after rename migration")
+	}
+	if !newPresent {
+		t.Errorf("new key entry missing after rename migration")
+	}
+}
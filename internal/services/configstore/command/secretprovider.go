@@ -0,0 +1,123 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"context"
+
+	"github.com/sorintlab/errors"
+
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+func toAPISecretProvider(sp *cstypes.SecretProvider) *csapitypes.SecretProvider {
+	return &csapitypes.SecretProvider{
+		ID:    sp.ID,
+		Name:  sp.Name,
+		Type:  sp.Type,
+		Vault: sp.Vault,
+		AWSSM: sp.AWSSM,
+		GCPSM: sp.GCPSM,
+		K8s:   sp.K8s,
+	}
+}
+
+func (c *CommandHandler) GetSecretProviders(ctx context.Context) ([]*csapitypes.SecretProvider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sps := make([]*csapitypes.SecretProvider, 0, len(c.secretProviders))
+	for _, sp := range c.secretProviders {
+		sps = append(sps, toAPISecretProvider(sp))
+	}
+
+	return sps, nil
+}
+
+func (c *CommandHandler) GetSecretProvider(ctx context.Context, id string) (*csapitypes.SecretProvider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	sp, ok := c.secretProviders[id]
+	if !ok {
+		return nil, errors.Wrapf(ErrNotExist, "secret provider %q", id)
+	}
+
+	return toAPISecretProvider(sp), nil
+}
+
+func (c *CommandHandler) CreateSecretProvider(ctx context.Context, req *csapitypes.CreateUpdateSecretProviderRequest) (*csapitypes.SecretProvider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, sp := range c.secretProviders {
+		if sp.Name == req.Name {
+			return nil, errors.Errorf("secret provider %q already exists", req.Name)
+		}
+	}
+
+	sp := &cstypes.SecretProvider{
+		ID:    genID(),
+		Name:  req.Name,
+		Type:  req.Type,
+		Vault: req.Vault,
+		AWSSM: req.AWSSM,
+		GCPSM: req.GCPSM,
+		K8s:   req.K8s,
+	}
+	c.secretProviders[sp.ID] = sp
+
+	return toAPISecretProvider(sp), nil
+}
+
+func (c *CommandHandler) UpdateSecretProvider(ctx context.Context, name string, req *csapitypes.CreateUpdateSecretProviderRequest) (*csapitypes.SecretProvider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var sp *cstypes.SecretProvider
+	for _, v := range c.secretProviders {
+		if v.Name == name {
+			sp = v
+			break
+		}
+	}
+	if sp == nil {
+		return nil, errors.Wrapf(ErrNotExist, "secret provider %q", name)
+	}
+
+	sp.Name = req.Name
+	sp.Type = req.Type
+	sp.Vault = req.Vault
+	sp.AWSSM = req.AWSSM
+	sp.GCPSM = req.GCPSM
+	sp.K8s = req.K8s
+
+	return toAPISecretProvider(sp), nil
+}
+
+func (c *CommandHandler) DeleteSecretProvider(ctx context.Context, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, sp := range c.secretProviders {
+		if sp.Name == name {
+			delete(c.secretProviders, id)
+			return nil
+		}
+	}
+
+	return errors.Wrapf(ErrNotExist, "secret provider %q", name)
+}
@@ -0,0 +1,63 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"context"
+
+	"github.com/sorintlab/errors"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+func (c *CommandHandler) GetProjectTriggerRules(ctx context.Context, projectID string) ([]*cstypes.TriggerRule, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.triggerRules[projectID], nil
+}
+
+func (c *CommandHandler) CreateProjectTriggerRule(ctx context.Context, projectID string, rule *cstypes.TriggerRule) (*cstypes.TriggerRule, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, tr := range c.triggerRules[projectID] {
+		if tr.Name == rule.Name {
+			return nil, errors.Errorf("trigger rule %q already exists for project %q", rule.Name, projectID)
+		}
+	}
+
+	created := *rule
+	created.ID = genID()
+	created.ProjectID = projectID
+	c.triggerRules[projectID] = append(c.triggerRules[projectID], &created)
+
+	return &created, nil
+}
+
+func (c *CommandHandler) DeleteProjectTriggerRule(ctx context.Context, projectID, name string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	rules := c.triggerRules[projectID]
+	for i, tr := range rules {
+		if tr.Name == name {
+			c.triggerRules[projectID] = append(rules[:i], rules[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.Wrapf(ErrNotExist, "trigger rule %q for project %q", name, projectID)
+}
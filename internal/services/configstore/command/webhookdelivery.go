@@ -0,0 +1,141 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"context"
+	"time"
+
+	"github.com/sorintlab/errors"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+// webhookDeliveryBackoff mirrors action.webhookDeliveryBackoff: the command
+// package has no dependency on the gateway action package, so the schedule
+// is duplicated rather than shared, the same way the two packages already
+// don't share code for anything else.
+func webhookDeliveryBackoff(attempts int) time.Duration {
+	const (
+		backoffBase = 30 * time.Second
+		backoffMax  = 30 * time.Minute
+	)
+
+	if attempts < 1 {
+		return 0
+	}
+
+	d := backoffBase
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= backoffMax {
+			return backoffMax
+		}
+	}
+
+	return d
+}
+
+func (c *CommandHandler) CreateProjectWebhookDelivery(ctx context.Context, projectID string, delivery *cstypes.WebhookDelivery) (*cstypes.WebhookDelivery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	created := *delivery
+	created.ID = genID()
+	created.ProjectID = projectID
+	created.ReceivedAt = time.Now()
+	c.webhookDeliveries[created.ID] = &created
+
+	if err := c.persistWebhookDeliveriesLocked(); err != nil {
+		delete(c.webhookDeliveries, created.ID)
+		return nil, errors.Wrapf(err, "failed to durably persist webhook delivery")
+	}
+
+	return &created, nil
+}
+
+func (c *CommandHandler) GetProjectWebhookDeliveries(ctx context.Context, projectID string, state cstypes.WebhookDeliveryState) ([]*cstypes.WebhookDelivery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var deliveries []*cstypes.WebhookDelivery
+	for _, d := range c.webhookDeliveries {
+		if d.ProjectID != projectID {
+			continue
+		}
+		if state != "" && d.State != state {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, nil
+}
+
+func (c *CommandHandler) GetProjectWebhookDelivery(ctx context.Context, projectID, deliveryID string) (*cstypes.WebhookDelivery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	d, ok := c.webhookDeliveries[deliveryID]
+	if !ok || d.ProjectID != projectID {
+		return nil, errors.Wrapf(ErrNotExist, "webhook delivery %q for project %q", deliveryID, projectID)
+	}
+
+	return d, nil
+}
+
+// GetPendingWebhookDeliveries returns every delivery across all projects
+// that's ready for a(nother) processing attempt: pending deliveries that
+// haven't been tried yet, and failed deliveries whose backoff has elapsed.
+// It backs the webhook delivery worker's poll loop.
+func (c *CommandHandler) GetPendingWebhookDeliveries(ctx context.Context) ([]*cstypes.WebhookDelivery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var deliveries []*cstypes.WebhookDelivery
+	for _, d := range c.webhookDeliveries {
+		switch d.State {
+		case cstypes.WebhookDeliveryStatePending:
+			deliveries = append(deliveries, d)
+		case cstypes.WebhookDeliveryStateFailed:
+			if d.LastAttempt.IsZero() || now.After(d.LastAttempt.Add(webhookDeliveryBackoff(d.Attempts))) {
+				deliveries = append(deliveries, d)
+			}
+		}
+	}
+
+	return deliveries, nil
+}
+
+func (c *CommandHandler) UpdateWebhookDelivery(ctx context.Context, delivery *cstypes.WebhookDelivery) (*cstypes.WebhookDelivery, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	previous, ok := c.webhookDeliveries[delivery.ID]
+	if !ok {
+		return nil, errors.Wrapf(ErrNotExist, "webhook delivery %q", delivery.ID)
+	}
+
+	updated := *delivery
+	c.webhookDeliveries[delivery.ID] = &updated
+
+	if err := c.persistWebhookDeliveriesLocked(); err != nil {
+		c.webhookDeliveries[delivery.ID] = previous
+		return nil, errors.Wrapf(err, "failed to durably persist webhook delivery")
+	}
+
+	return &updated, nil
+}
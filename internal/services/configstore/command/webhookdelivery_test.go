@@ -0,0 +1,119 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+func TestGetPendingWebhookDeliveries(t *testing.T) {
+	ctx := context.Background()
+	ch, err := NewCommandHandler(nil, "")
+	if err != nil {
+		t.Fatalf("NewCommandHandler() error = %v", err)
+	}
+
+	pending, err := ch.CreateProjectWebhookDelivery(ctx, "proj1", &cstypes.WebhookDelivery{State: cstypes.WebhookDeliveryStatePending})
+	if err != nil {
+		t.Fatalf("CreateProjectWebhookDelivery() error = %v", err)
+	}
+
+	recentlyFailed, err := ch.CreateProjectWebhookDelivery(ctx, "proj1", &cstypes.WebhookDelivery{State: cstypes.WebhookDeliveryStateFailed})
+	if err != nil {
+		t.Fatalf("CreateProjectWebhookDelivery() error = %v", err)
+	}
+	recentlyFailed.State = cstypes.WebhookDeliveryStateFailed
+	recentlyFailed.Attempts = 1
+	recentlyFailed.LastAttempt = time.Now()
+	if _, err := ch.UpdateWebhookDelivery(ctx, recentlyFailed); err != nil {
+		t.Fatalf("UpdateWebhookDelivery() error = %v", err)
+	}
+
+	readyFailed, err := ch.CreateProjectWebhookDelivery(ctx, "proj1", &cstypes.WebhookDelivery{State: cstypes.WebhookDeliveryStateFailed})
+	if err != nil {
+		t.Fatalf("CreateProjectWebhookDelivery() error = %v", err)
+	}
+	readyFailed.State = cstypes.WebhookDeliveryStateFailed
+	readyFailed.Attempts = 1
+	readyFailed.LastAttempt = time.Now().Add(-time.Hour)
+	if _, err := ch.UpdateWebhookDelivery(ctx, readyFailed); err != nil {
+		t.Fatalf("UpdateWebhookDelivery() error = %v", err)
+	}
+
+	delivered, err := ch.CreateProjectWebhookDelivery(ctx, "proj1", &cstypes.WebhookDelivery{State: cstypes.WebhookDeliveryStateDelivered})
+	if err != nil {
+		t.Fatalf("CreateProjectWebhookDelivery() error = %v", err)
+	}
+
+	ready, err := ch.GetPendingWebhookDeliveries(ctx)
+	if err != nil {
+		t.Fatalf("GetPendingWebhookDeliveries() error = %v", err)
+	}
+
+	gotIDs := map[string]bool{}
+	for _, d := range ready {
+		gotIDs[d.ID] = true
+	}
+
+	if !gotIDs[pending.ID] {
+		t.Errorf("expected pending delivery %s to be ready", pending.ID)
+	}
+	if !gotIDs[readyFailed.ID] {
+		t.Errorf("expected backed-off failed delivery %s to be ready", readyFailed.ID)
+	}
+	if gotIDs[recentlyFailed.ID] {
+		t.Errorf("didn't expect recently failed delivery %s to be ready", recentlyFailed.ID)
+	}
+	if gotIDs[delivered.ID] {
+		t.Errorf("didn't expect delivered delivery %s to be ready", delivered.ID)
+	}
+}
+
+// TestWebhookDeliveriesSurviveRestart checks the durability guarantee the
+// webhook inbox exists to provide: a delivery persisted by one
+// CommandHandler is still there, in the same state, when a new
+// CommandHandler is created against the same dataDir (simulating a process
+// restart), instead of being lost along with the first instance's memory.
+func TestWebhookDeliveriesSurviveRestart(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+
+	ch1, err := NewCommandHandler(nil, dataDir)
+	if err != nil {
+		t.Fatalf("NewCommandHandler() error = %v", err)
+	}
+
+	created, err := ch1.CreateProjectWebhookDelivery(ctx, "proj1", &cstypes.WebhookDelivery{State: cstypes.WebhookDeliveryStatePending, Body: []byte("payload")})
+	if err != nil {
+		t.Fatalf("CreateProjectWebhookDelivery() error = %v", err)
+	}
+
+	ch2, err := NewCommandHandler(nil, dataDir)
+	if err != nil {
+		t.Fatalf("NewCommandHandler() error = %v", err)
+	}
+
+	got, err := ch2.GetProjectWebhookDelivery(ctx, "proj1", created.ID)
+	if err != nil {
+		t.Fatalf("GetProjectWebhookDelivery() error = %v", err)
+	}
+	if got.State != cstypes.WebhookDeliveryStatePending || string(got.Body) != "payload" {
+		t.Errorf("reloaded delivery = %+v, want state %q and body %q", got, cstypes.WebhookDeliveryStatePending, "payload")
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package command
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/sorintlab/errors"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+// webhookDeliveryStoreFile is the name of the durable webhook inbox file
+// inside the data dir passed to NewCommandHandler.
+const webhookDeliveryStoreFile = "webhookdeliveries.json"
+
+// loadWebhookDeliveries reads the durable webhook inbox from dataDir, so a
+// restarted process picks back up every pending/failed/dead-lettered
+// delivery instead of losing it. A missing file means there's nothing to
+// load yet (e.g. first run) and isn't an error.
+func loadWebhookDeliveries(dataDir string) (map[string]*cstypes.WebhookDelivery, error) {
+	deliveries := map[string]*cstypes.WebhookDelivery{}
+	if dataDir == "" {
+		return deliveries, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dataDir, webhookDeliveryStoreFile))
+	if os.IsNotExist(err) {
+		return deliveries, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read webhook delivery store")
+	}
+
+	if err := json.Unmarshal(data, &deliveries); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal webhook delivery store")
+	}
+
+	return deliveries, nil
+}
+
+// persistWebhookDeliveriesLocked durably writes c.webhookDeliveries to
+// c.dataDir, so a delivery isn't considered saved until it's actually on
+// disk. It must be called with c.mu held. A no-op when c.dataDir is empty
+// (in-memory-only, e.g. in unit tests that don't care about durability).
+//
+// The write is atomic: it writes to a temp file in the same directory, then
+// renames it over the real path, so a crash mid-write can never leave a
+// truncated/corrupt store behind.
+func (c *CommandHandler) persistWebhookDeliveriesLocked() error {
+	if c.dataDir == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(c.webhookDeliveries)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal webhook delivery store")
+	}
+
+	path := filepath.Join(c.dataDir, webhookDeliveryStoreFile)
+	tmp, err := os.CreateTemp(c.dataDir, ".webhookdeliveries-*.tmp")
+	if err != nil {
+		return errors.Wrapf(err, "failed to create temp webhook delivery store file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "failed to write webhook delivery store")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close temp webhook delivery store file")
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrapf(err, "failed to persist webhook delivery store")
+	}
+
+	return nil
+}
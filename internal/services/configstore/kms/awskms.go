@@ -0,0 +1,334 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sorintlab/errors"
+)
+
+const (
+	awsKMSMetadataBaseURL = "http://169.254.169.254/latest"
+	awsKMSHTTPTimeout     = 10 * time.Second
+)
+
+// AWSKMSConfig points at an AWS KMS key used to wrap/unwrap DEKs via its
+// Encrypt/Decrypt RPCs.
+type AWSKMSConfig struct {
+	Region string
+	KeyID  string
+}
+
+type awsKMSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// awsKMSProvider wraps/unwraps DEKs with an AWS KMS key, authenticating with
+// the EC2 instance profile (via IMDSv2) unless static AWS_ACCESS_KEY_ID/
+// AWS_SECRET_ACCESS_KEY env vars are set. ECS task role credentials are not
+// fetched, and it does not support assuming a separate role: AWSKMSConfig
+// has no RoleARN to assume.
+type awsKMSProvider struct {
+	config      *AWSKMSConfig
+	hc          *http.Client
+	metadataURL string
+	kmsURL      string
+}
+
+func newAWSKMSProvider(c *AWSKMSConfig) (*awsKMSProvider, error) {
+	if c == nil {
+		return nil, errors.Errorf("missing aws kms config")
+	}
+	if c.Region == "" {
+		return nil, errors.Errorf("missing aws kms region")
+	}
+	if c.KeyID == "" {
+		return nil, errors.Errorf("missing aws kms key id")
+	}
+
+	return &awsKMSProvider{
+		config:      c,
+		hc:          &http.Client{Timeout: awsKMSHTTPTimeout},
+		metadataURL: awsKMSMetadataBaseURL,
+		kmsURL:      fmt.Sprintf("https://kms.%s.amazonaws.com/", c.Region),
+	}, nil
+}
+
+func (p *awsKMSProvider) KEKID() string {
+	return "awskms:" + p.config.KeyID
+}
+
+// WrapDEK calls KMS Encrypt on dek, returning the raw CiphertextBlob.
+func (p *awsKMSProvider) WrapDEK(ctx context.Context, dek []byte) ([]byte, string, error) {
+	creds, err := p.credentials(ctx)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to get aws credentials")
+	}
+
+	reqBody, err := json.Marshal(map[string]string{
+		"KeyId":     p.config.KeyID,
+		"Plaintext": base64.StdEncoding.EncodeToString(dek),
+	})
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to marshal kms encrypt request")
+	}
+
+	var resp struct {
+		CiphertextBlob string `json:"CiphertextBlob"`
+	}
+	if err := p.signedJSONRequest(ctx, creds, "TrentService.Encrypt", reqBody, &resp); err != nil {
+		return nil, "", errors.Wrapf(err, "kms encrypt failed")
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(resp.CiphertextBlob)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to decode kms ciphertext")
+	}
+
+	return wrapped, p.KEKID(), nil
+}
+
+// UnwrapDEK calls KMS Decrypt on wrappedDEK, returning the plaintext DEK.
+func (p *awsKMSProvider) UnwrapDEK(ctx context.Context, wrappedDEK []byte, kekID string) ([]byte, error) {
+	if kekID != p.KEKID() {
+		return nil, errors.Errorf("aws kms key rotated: wrapped dek belongs to kek %q, have %q", kekID, p.KEKID())
+	}
+
+	creds, err := p.credentials(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get aws credentials")
+	}
+
+	reqBody, err := json.Marshal(map[string]string{
+		"KeyId":          p.config.KeyID,
+		"CiphertextBlob": base64.StdEncoding.EncodeToString(wrappedDEK),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal kms decrypt request")
+	}
+
+	var resp struct {
+		Plaintext string `json:"Plaintext"`
+	}
+	if err := p.signedJSONRequest(ctx, creds, "TrentService.Decrypt", reqBody, &resp); err != nil {
+		return nil, errors.Wrapf(err, "kms decrypt failed")
+	}
+
+	dek, err := base64.StdEncoding.DecodeString(resp.Plaintext)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode kms plaintext")
+	}
+
+	return dek, nil
+}
+
+func (p *awsKMSProvider) credentials(ctx context.Context) (awsKMSCredentials, error) {
+	if ak := os.Getenv("AWS_ACCESS_KEY_ID"); ak != "" {
+		return awsKMSCredentials{
+			AccessKeyID:     ak,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	return p.instanceProfileCredentials(ctx)
+}
+
+// instanceProfileCredentials fetches the EC2 instance profile's temporary
+// credentials via IMDSv2.
+func (p *awsKMSProvider) instanceProfileCredentials(ctx context.Context) (awsKMSCredentials, error) {
+	token, err := p.metadataGet(ctx, p.metadataURL+"/api/token", "", http.MethodPut, map[string]string{
+		"X-aws-ec2-metadata-token-ttl-seconds": "21600",
+	})
+	if err != nil {
+		return awsKMSCredentials{}, errors.Wrapf(err, "failed to get imds token")
+	}
+
+	roleName, err := p.metadataGet(ctx, p.metadataURL+"/meta-data/iam/security-credentials/", token, http.MethodGet, nil)
+	if err != nil {
+		return awsKMSCredentials{}, errors.Wrapf(err, "failed to get instance profile role name")
+	}
+	roleName = strings.TrimSpace(roleName)
+
+	credsJSON, err := p.metadataGet(ctx, p.metadataURL+"/meta-data/iam/security-credentials/"+roleName, token, http.MethodGet, nil)
+	if err != nil {
+		return awsKMSCredentials{}, errors.Wrapf(err, "failed to get instance profile credentials")
+	}
+
+	var creds struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		Token           string `json:"Token"`
+	}
+	if err := json.Unmarshal([]byte(credsJSON), &creds); err != nil {
+		return awsKMSCredentials{}, errors.Wrapf(err, "failed to decode instance profile credentials")
+	}
+
+	return awsKMSCredentials{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.Token,
+	}, nil
+}
+
+func (p *awsKMSProvider) metadataGet(ctx context.Context, url, token, method string, headers map[string]string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create metadata request")
+	}
+	if token != "" {
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := p.hc.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "metadata request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", errors.Errorf("metadata request to %q failed with status %d", url, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read metadata response")
+	}
+
+	return string(body), nil
+}
+
+// signedJSONRequest issues a SigV4-signed JSON-protocol POST against the KMS
+// endpoint and JSON-decodes the response body into out.
+func (p *awsKMSProvider) signedJSONRequest(ctx context.Context, creds awsKMSCredentials, target string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.kmsURL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create kms request")
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+
+	if err := signAWSKMSRequestV4(req, body, creds, p.config.Region); err != nil {
+		return errors.Wrapf(err, "failed to sign kms request")
+	}
+
+	resp, err := p.hc.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "kms request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("kms request failed with status %d", resp.StatusCode)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return errors.Wrapf(err, "failed to decode kms response")
+		}
+	}
+
+	return nil
+}
+
+// signAWSKMSRequestV4 signs req with AWS Signature Version 4 for the "kms"
+// service.
+func signAWSKMSRequestV4(req *http.Request, body []byte, creds awsKMSCredentials, region string) error {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+	payloadHash := awsKMSSHA256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("Host", req.URL.Host)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	signedHeaders := []string{"content-type", "host", "x-amz-date"}
+	if creds.SessionToken != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", h, strings.TrimSpace(req.Header.Get(http.CanonicalHeaderKey(h))))
+	}
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		"",
+		canonicalHeaders.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+
+	credentialScope := fmt.Sprintf("%s/%s/kms/aws4_request", dateStamp, region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		credentialScope,
+		awsKMSSHA256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := awsKMSSigningKey(creds.SecretAccessKey, dateStamp, region)
+	signature := hex.EncodeToString(awsKMSHMACSHA256(signingKey, []byte(stringToSign)))
+
+	authHeader := fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, credentialScope, strings.Join(signedHeaders, ";"), signature)
+	req.Header.Set("Authorization", authHeader)
+
+	return nil
+}
+
+func awsKMSSigningKey(secretKey, dateStamp, region string) []byte {
+	kDate := awsKMSHMACSHA256([]byte("AWS4"+secretKey), []byte(dateStamp))
+	kRegion := awsKMSHMACSHA256(kDate, []byte(region))
+	kService := awsKMSHMACSHA256(kRegion, []byte("kms"))
+	return awsKMSHMACSHA256(kService, []byte("aws4_request"))
+}
+
+func awsKMSHMACSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func awsKMSSHA256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
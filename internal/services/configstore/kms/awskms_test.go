@@ -0,0 +1,120 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAWSKMSProviderWrapUnwrapDEK(t *testing.T) {
+	dek := []byte("0123456789abcdef0123456789abcdef")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.Encrypt":
+			var req map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req["Plaintext"] != base64.StdEncoding.EncodeToString(dek) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"CiphertextBlob": base64.StdEncoding.EncodeToString([]byte("wrapped-dek")),
+			})
+		case "TrentService.Decrypt":
+			var req map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req["CiphertextBlob"] != base64.StdEncoding.EncodeToString([]byte("wrapped-dek")) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"Plaintext": base64.StdEncoding.EncodeToString(dek),
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret")
+
+	provider, err := newAWSKMSProvider(&AWSKMSConfig{Region: "us-east-1", KeyID: "alias/dek-key"})
+	if err != nil {
+		t.Fatalf("newAWSKMSProvider() error = %v", err)
+	}
+	provider.hc = srv.Client()
+	provider.kmsURL = srv.URL
+
+	wrapped, kekID, err := provider.WrapDEK(context.Background(), dek)
+	if err != nil {
+		t.Fatalf("WrapDEK() error = %v", err)
+	}
+	if kekID != provider.KEKID() {
+		t.Fatalf("WrapDEK() kekID = %q, want %q", kekID, provider.KEKID())
+	}
+
+	unwrapped, err := provider.UnwrapDEK(context.Background(), wrapped, kekID)
+	if err != nil {
+		t.Fatalf("UnwrapDEK() error = %v", err)
+	}
+	if string(unwrapped) != string(dek) {
+		t.Fatalf("UnwrapDEK() = %q, want %q", unwrapped, dek)
+	}
+}
+
+func TestAWSKMSProviderWrapDEKForbidden(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret")
+
+	provider, err := newAWSKMSProvider(&AWSKMSConfig{Region: "us-east-1", KeyID: "alias/dek-key"})
+	if err != nil {
+		t.Fatalf("newAWSKMSProvider() error = %v", err)
+	}
+	provider.hc = srv.Client()
+	provider.kmsURL = srv.URL
+
+	if _, _, err := provider.WrapDEK(context.Background(), []byte("dek")); err == nil {
+		t.Fatal("WrapDEK() expected error, got nil")
+	}
+}
+
+func TestAWSKMSProviderUnwrapDEKWrongKEK(t *testing.T) {
+	provider, err := newAWSKMSProvider(&AWSKMSConfig{Region: "us-east-1", KeyID: "alias/dek-key"})
+	if err != nil {
+		t.Fatalf("newAWSKMSProvider() error = %v", err)
+	}
+
+	if _, err := provider.UnwrapDEK(context.Background(), []byte("x"), "awskms:other-key"); err == nil {
+		t.Fatal("UnwrapDEK() expected error for mismatched kek, got nil")
+	}
+}
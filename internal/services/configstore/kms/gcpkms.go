@@ -0,0 +1,186 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/sorintlab/errors"
+)
+
+const (
+	gcpKMSMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	gcpKMSBaseURL          = "https://cloudkms.googleapis.com/v1"
+	gcpKMSHTTPTimeout      = 10 * time.Second
+)
+
+// GCPKMSConfig points at a GCP KMS CryptoKey used to wrap/unwrap DEKs via
+// its Encrypt/Decrypt RPCs.
+type GCPKMSConfig struct {
+	ProjectID string
+	Location  string
+	KeyRing   string
+	CryptoKey string
+}
+
+// gcpKMSProvider wraps/unwraps DEKs with a GCP KMS CryptoKey, authenticating
+// with the ambient application default credentials (the GCE/GKE metadata
+// server).
+type gcpKMSProvider struct {
+	config           *GCPKMSConfig
+	hc               *http.Client
+	metadataTokenURL string
+	kmsBaseURL       string
+}
+
+func newGCPKMSProvider(c *GCPKMSConfig) (*gcpKMSProvider, error) {
+	if c == nil {
+		return nil, errors.Errorf("missing gcp kms config")
+	}
+	if c.ProjectID == "" || c.Location == "" || c.KeyRing == "" || c.CryptoKey == "" {
+		return nil, errors.Errorf("missing gcp kms project id, location, key ring or crypto key")
+	}
+
+	return &gcpKMSProvider{
+		config:           c,
+		hc:               &http.Client{Timeout: gcpKMSHTTPTimeout},
+		metadataTokenURL: gcpKMSMetadataTokenURL,
+		kmsBaseURL:       gcpKMSBaseURL,
+	}, nil
+}
+
+func (p *gcpKMSProvider) KEKID() string {
+	return "gcpkms:" + p.config.ProjectID + "/" + p.config.Location + "/" + p.config.KeyRing + "/" + p.config.CryptoKey
+}
+
+func (p *gcpKMSProvider) cryptoKeyURL() string {
+	return fmt.Sprintf("%s/projects/%s/locations/%s/keyRings/%s/cryptoKeys/%s",
+		p.kmsBaseURL, p.config.ProjectID, p.config.Location, p.config.KeyRing, p.config.CryptoKey)
+}
+
+// WrapDEK calls the CryptoKey's encrypt RPC on dek, returning the raw
+// decoded ciphertext.
+func (p *gcpKMSProvider) WrapDEK(ctx context.Context, dek []byte) ([]byte, string, error) {
+	var resp struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	reqBody := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dek)}
+	if err := p.call(ctx, p.cryptoKeyURL()+":encrypt", reqBody, &resp); err != nil {
+		return nil, "", errors.Wrapf(err, "gcp kms encrypt failed")
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(resp.Ciphertext)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to decode gcp kms ciphertext")
+	}
+
+	return wrapped, p.KEKID(), nil
+}
+
+// UnwrapDEK calls the CryptoKey's decrypt RPC on wrappedDEK, returning the
+// plaintext DEK.
+func (p *gcpKMSProvider) UnwrapDEK(ctx context.Context, wrappedDEK []byte, kekID string) ([]byte, error) {
+	if kekID != p.KEKID() {
+		return nil, errors.Errorf("gcp kms key rotated: wrapped dek belongs to kek %q, have %q", kekID, p.KEKID())
+	}
+
+	var resp struct {
+		Plaintext string `json:"plaintext"`
+	}
+	reqBody := map[string]string{"ciphertext": base64.StdEncoding.EncodeToString(wrappedDEK)}
+	if err := p.call(ctx, p.cryptoKeyURL()+":decrypt", reqBody, &resp); err != nil {
+		return nil, errors.Wrapf(err, "gcp kms decrypt failed")
+	}
+
+	dek, err := base64.StdEncoding.DecodeString(resp.Plaintext)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode gcp kms plaintext")
+	}
+
+	return dek, nil
+}
+
+func (p *gcpKMSProvider) call(ctx context.Context, url string, reqBody, out interface{}) error {
+	token, err := p.accessToken(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get application default credentials token")
+	}
+
+	b, err := json.Marshal(reqBody)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal gcp kms request")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create gcp kms request")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.hc.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "gcp kms request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("gcp kms request to %q failed with status %d", url, resp.StatusCode)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return errors.Wrapf(err, "failed to decode gcp kms response")
+		}
+	}
+
+	return nil
+}
+
+// accessToken fetches an OAuth2 access token for the instance/pod's
+// attached service account from the GCE/GKE metadata server.
+func (p *gcpKMSProvider) accessToken(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.metadataTokenURL, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create metadata request")
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := p.hc.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "metadata request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", errors.Errorf("metadata request to %q failed with status %d", p.metadataTokenURL, resp.StatusCode)
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", errors.Wrapf(err, "failed to decode metadata token response")
+	}
+	if tokenResp.AccessToken == "" {
+		return "", errors.Errorf("metadata server returned no access token")
+	}
+
+	return tokenResp.AccessToken, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kms provides the KEK (key-encryption-key) backends used to wrap
+// and unwrap per-secret DEKs for configstore's envelope encryption of
+// secrets. It never sees a secret's plaintext Data, only its DEK.
+package kms
+
+import (
+	"context"
+
+	"github.com/sorintlab/errors"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+// KMSProvider wraps and unwraps a per-secret DEK with a KEK it owns. KEKID
+// identifies which KEK a given WrappedDEK was wrapped with; UnwrapDEK
+// rejects a kekID other than the provider's own KEKID(), so a DEK wrapped
+// under a since-rotated KEK is unwrapped by the provider holding that KEK
+// (as command.RotateKEK does with its old provider).
+type KMSProvider interface {
+	// KEKID is the identifier of the KEK this provider currently wraps new
+	// DEKs with.
+	KEKID() string
+
+	WrapDEK(ctx context.Context, dek []byte) (wrappedDEK []byte, kekID string, err error)
+	UnwrapDEK(ctx context.Context, wrappedDEK []byte, kekID string) (dek []byte, err error)
+}
+
+// Config selects and configures one of the supported KMS backends.
+type Config struct {
+	Type KMSProviderType
+
+	// Local is the local, file-based master key backend: a single KEK
+	// whose bytes live in a file on disk, meant for development/single
+	// node setups rather than production use.
+	Local *LocalConfig
+
+	VaultTransit *VaultTransitConfig
+	AWSKMS       *AWSKMSConfig
+	GCPKMS       *GCPKMSConfig
+}
+
+type KMSProviderType = cstypes.KMSProviderType
+
+const (
+	KMSProviderTypeLocal        = cstypes.KMSProviderTypeLocal
+	KMSProviderTypeVaultTransit = cstypes.KMSProviderTypeVaultTransit
+	KMSProviderTypeAWSKMS       = cstypes.KMSProviderTypeAWSKMS
+	KMSProviderTypeGCPKMS       = cstypes.KMSProviderTypeGCPKMS
+)
+
+// NewKMSProvider builds the KMSProvider for c.Type.
+func NewKMSProvider(c *Config) (KMSProvider, error) {
+	switch c.Type {
+	case KMSProviderTypeLocal:
+		return newLocalKMSProvider(c.Local)
+	case KMSProviderTypeVaultTransit:
+		return newVaultTransitKMSProvider(c.VaultTransit)
+	case KMSProviderTypeAWSKMS:
+		return newAWSKMSProvider(c.AWSKMS)
+	case KMSProviderTypeGCPKMS:
+		return newGCPKMSProvider(c.GCPKMS)
+	default:
+		return nil, errors.Errorf("unknown kms provider type %q", c.Type)
+	}
+}
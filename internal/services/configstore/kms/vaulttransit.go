@@ -0,0 +1,223 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sorintlab/errors"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+const (
+	defaultKubernetesServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	vaultTransitHTTPTimeout                  = 10 * time.Second
+)
+
+// VaultTransitConfig points at a HashiCorp Vault transit engine mount that
+// holds the KEK; wrap/unwrap are the transit engine's encrypt/decrypt
+// endpoints, so the KEK material never leaves Vault. Authentication mirrors
+// the secret provider's Vault config: AppRole or Kubernetes auth.
+type VaultTransitConfig struct {
+	Addr      string
+	MountPath string
+	KeyName   string
+
+	AuthType cstypes.VaultAuthType
+
+	// AppRole auth
+	RoleID   string
+	SecretID string
+
+	// Kubernetes auth
+	KubernetesRole     string
+	KubernetesAuthPath string
+}
+
+type vaultTransitKMSProvider struct {
+	config *VaultTransitConfig
+	hc     *http.Client
+}
+
+func newVaultTransitKMSProvider(c *VaultTransitConfig) (*vaultTransitKMSProvider, error) {
+	if c == nil {
+		return nil, errors.Errorf("missing vault transit config")
+	}
+	if c.Addr == "" {
+		return nil, errors.Errorf("missing vault transit addr")
+	}
+	if c.MountPath == "" {
+		return nil, errors.Errorf("missing vault transit mount path")
+	}
+	if c.KeyName == "" {
+		return nil, errors.Errorf("missing vault transit key name")
+	}
+
+	return &vaultTransitKMSProvider{config: c, hc: &http.Client{Timeout: vaultTransitHTTPTimeout}}, nil
+}
+
+func (p *vaultTransitKMSProvider) KEKID() string {
+	return "vaulttransit:" + p.config.MountPath + "/" + p.config.KeyName
+}
+
+// WrapDEK encrypts dek with the transit engine's encrypt endpoint. The
+// returned wrappedDEK is the raw bytes of Vault's own versioned ciphertext
+// token (e.g. "vault:v1:..."), which Vault can unwrap even after the key
+// has since been rotated.
+func (p *vaultTransitKMSProvider) WrapDEK(ctx context.Context, dek []byte) ([]byte, string, error) {
+	token, err := p.login(ctx)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to login to vault")
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/encrypt/%s", strings.TrimSuffix(p.config.Addr, "/"), p.config.MountPath, p.config.KeyName)
+	reqBody := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dek)}
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	if err := p.do(ctx, http.MethodPost, url, token, reqBody, &resp); err != nil {
+		return nil, "", errors.Wrapf(err, "failed to encrypt dek with vault transit")
+	}
+
+	return []byte(resp.Data.Ciphertext), p.KEKID(), nil
+}
+
+// UnwrapDEK decrypts wrappedDEK with the transit engine's decrypt endpoint.
+// kekID only identifies which mount/key to talk to; the actual key version
+// used to encrypt is embedded in wrappedDEK itself and handled by Vault.
+func (p *vaultTransitKMSProvider) UnwrapDEK(ctx context.Context, wrappedDEK []byte, kekID string) ([]byte, error) {
+	if kekID != p.KEKID() {
+		return nil, errors.Errorf("vault transit key rotated: wrapped dek belongs to kek %q, have %q", kekID, p.KEKID())
+	}
+
+	token, err := p.login(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to login to vault")
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/decrypt/%s", strings.TrimSuffix(p.config.Addr, "/"), p.config.MountPath, p.config.KeyName)
+	reqBody := map[string]string{"ciphertext": string(wrappedDEK)}
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := p.do(ctx, http.MethodPost, url, token, reqBody, &resp); err != nil {
+		return nil, errors.Wrapf(err, "failed to decrypt dek with vault transit")
+	}
+
+	dek, err := base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode decrypted dek")
+	}
+
+	return dek, nil
+}
+
+// login authenticates to Vault using AppRole or Kubernetes auth and returns
+// a client token, which is discarded by the caller as soon as the
+// encrypt/decrypt call completes.
+func (p *vaultTransitKMSProvider) login(ctx context.Context) (string, error) {
+	var loginPath string
+	var loginReq map[string]string
+
+	switch p.config.AuthType {
+	case cstypes.VaultAuthTypeAppRole:
+		if p.config.RoleID == "" || p.config.SecretID == "" {
+			return "", errors.Errorf("approle auth requires role_id and secret_id")
+		}
+		loginPath = "/v1/auth/approle/login"
+		loginReq = map[string]string{"role_id": p.config.RoleID, "secret_id": p.config.SecretID}
+	case cstypes.VaultAuthTypeKubernetes:
+		authPath := p.config.KubernetesAuthPath
+		if authPath == "" {
+			authPath = "kubernetes"
+		}
+		jwt, err := os.ReadFile(defaultKubernetesServiceAccountTokenPath)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to read kubernetes service account token")
+		}
+		loginPath = fmt.Sprintf("/v1/auth/%s/login", authPath)
+		loginReq = map[string]string{"role": p.config.KubernetesRole, "jwt": string(jwt)}
+	default:
+		return "", errors.Errorf("unsupported vault auth type %q", p.config.AuthType)
+	}
+
+	url := strings.TrimSuffix(p.config.Addr, "/") + loginPath
+	var loginResp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := p.do(ctx, http.MethodPost, url, "", loginReq, &loginResp); err != nil {
+		return "", err
+	}
+	if loginResp.Auth.ClientToken == "" {
+		return "", errors.Errorf("vault login response has no client token")
+	}
+
+	return loginResp.Auth.ClientToken, nil
+}
+
+func (p *vaultTransitKMSProvider) do(ctx context.Context, method, url, token string, body, out interface{}) error {
+	var bodyReader *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrapf(err, "failed to marshal vault request")
+		}
+		bodyReader = bytes.NewReader(b)
+	} else {
+		bodyReader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create vault request")
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.hc.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "vault request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("vault request to %q failed with status %d", url, resp.StatusCode)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return errors.Wrapf(err, "failed to decode vault response")
+		}
+	}
+
+	return nil
+}
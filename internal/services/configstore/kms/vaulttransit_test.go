@@ -0,0 +1,122 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kms
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+func TestVaultTransitKMSProviderWrapUnwrapDEK(t *testing.T) {
+	dek := []byte("0123456789abcdef0123456789abcdef")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			var req map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req["role_id"] != "test-role" || req["secret_id"] != "test-secret" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]string{"client_token": "test-token"},
+			})
+		case "/v1/transit/encrypt/dek-key":
+			if r.Header.Get("X-Vault-Token") != "test-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			var req map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req["plaintext"] != base64.StdEncoding.EncodeToString(dek) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]string{"ciphertext": "vault:v1:faketoken"},
+			})
+		case "/v1/transit/decrypt/dek-key":
+			if r.Header.Get("X-Vault-Token") != "test-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			var req map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req["ciphertext"] != "vault:v1:faketoken" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]string{"plaintext": base64.StdEncoding.EncodeToString(dek)},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	provider, err := newVaultTransitKMSProvider(&VaultTransitConfig{
+		Addr:      srv.URL,
+		MountPath: "transit",
+		KeyName:   "dek-key",
+		AuthType:  cstypes.VaultAuthTypeAppRole,
+		RoleID:    "test-role",
+		SecretID:  "test-secret",
+	})
+	if err != nil {
+		t.Fatalf("newVaultTransitKMSProvider() error = %v", err)
+	}
+
+	wrapped, kekID, err := provider.WrapDEK(context.Background(), dek)
+	if err != nil {
+		t.Fatalf("WrapDEK() error = %v", err)
+	}
+	if kekID != provider.KEKID() {
+		t.Fatalf("WrapDEK() kekID = %q, want %q", kekID, provider.KEKID())
+	}
+
+	unwrapped, err := provider.UnwrapDEK(context.Background(), wrapped, kekID)
+	if err != nil {
+		t.Fatalf("UnwrapDEK() error = %v", err)
+	}
+	if string(unwrapped) != string(dek) {
+		t.Fatalf("UnwrapDEK() = %q, want %q", unwrapped, dek)
+	}
+}
+
+func TestVaultTransitKMSProviderUnwrapDEKWrongKEK(t *testing.T) {
+	provider, err := newVaultTransitKMSProvider(&VaultTransitConfig{
+		Addr:      "http://unused",
+		MountPath: "transit",
+		KeyName:   "dek-key",
+		AuthType:  cstypes.VaultAuthTypeAppRole,
+		RoleID:    "test-role",
+		SecretID:  "test-secret",
+	})
+	if err != nil {
+		t.Fatalf("newVaultTransitKMSProvider() error = %v", err)
+	}
+
+	if _, err := provider.UnwrapDEK(context.Background(), []byte("x"), "vaulttransit:other/key"); err == nil {
+		t.Fatal("UnwrapDEK() expected error for mismatched kek, got nil")
+	}
+}
@@ -0,0 +1,354 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/sorintlab/errors"
+
+	"agola.io/agola/internal/services/types"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+// ParsedEvent is the outcome of running a TriggerRule's EventAdapter against
+// an incoming request: enough to build a CreateRunRequest for the matched
+// project.
+type ParsedEvent struct {
+	RefType      types.RunRefType
+	Ref          string
+	CommitSHA    string
+	TemplateVars map[string]string
+}
+
+// EventAdapter turns an arbitrary event delivery (generic JSON, Docker
+// registry image-push, container registry event, CloudEvents envelope) into
+// a ParsedEvent, using rule to verify the sender and select the fields that
+// matter out of the payload. Implementations must not assume the payload
+// matches their expected shape and should return a descriptive error when it
+// doesn't, rather than panicking on a bad JSONPath lookup.
+type EventAdapter interface {
+	// Verify checks the request signature/authenticity, e.g. an HMAC header
+	// computed over the raw body with the rule's shared secret.
+	Verify(r *http.Request, body []byte, rule *cstypes.TriggerRule) error
+
+	// Parse extracts the run ref, type, commit sha and template variables
+	// out of body according to rule's JSONPath selectors.
+	Parse(body []byte, rule *cstypes.TriggerRule) (*ParsedEvent, error)
+}
+
+// GetEventAdapter returns the EventAdapter that handles adapterType.
+func GetEventAdapter(adapterType cstypes.EventAdapterType) (EventAdapter, error) {
+	switch adapterType {
+	case cstypes.EventAdapterTypeGeneric:
+		return &genericEventAdapter{}, nil
+	case cstypes.EventAdapterTypeDockerRegistry:
+		return &dockerRegistryEventAdapter{}, nil
+	case cstypes.EventAdapterTypeContainerRegistry:
+		return &containerRegistryEventAdapter{}, nil
+	case cstypes.EventAdapterTypeCloudEvents:
+		return &cloudEventsEventAdapter{}, nil
+	default:
+		return nil, errors.Errorf("unknown event adapter type %q", adapterType)
+	}
+}
+
+// genericEventAdapter matches an arbitrary JSON payload purely via the
+// rule's JSONPath selectors, with no assumptions about its shape.
+type genericEventAdapter struct{}
+
+func (a *genericEventAdapter) Verify(r *http.Request, body []byte, rule *cstypes.TriggerRule) error {
+	return verifySignature(r, body, rule)
+}
+
+func (a *genericEventAdapter) Parse(body []byte, rule *cstypes.TriggerRule) (*ParsedEvent, error) {
+	return parseWithJSONPath(body, rule)
+}
+
+// dockerRegistryEventAdapter understands Docker Registry v2 notification
+// events (https://docs.docker.com/registry/notifications/): a top-level
+// "events" array, batched and potentially containing non-push actions
+// (pull, delete, mount) alongside the push that should trigger a run. When
+// the rule doesn't override RefJSONPath, the ref defaults to the first
+// "push" event's target tag instead of requiring every rule to spell out
+// the same selector; RefTypeJSONPath/CommitSHAJSONPath/TemplateVarsJSONPath
+// still run against the payload in that case, same as when RefJSONPath is
+// set.
+type dockerRegistryEventAdapter struct{}
+
+func (a *dockerRegistryEventAdapter) Verify(r *http.Request, body []byte, rule *cstypes.TriggerRule) error {
+	return verifySignature(r, body, rule)
+}
+
+func (a *dockerRegistryEventAdapter) Parse(body []byte, rule *cstypes.TriggerRule) (*ParsedEvent, error) {
+	if rule.RefJSONPath != "" {
+		return parseWithJSONPath(body, rule)
+	}
+
+	var notification struct {
+		Events []struct {
+			Action string `json:"action"`
+			Target struct {
+				Tag    string `json:"tag"`
+				Digest string `json:"digest"`
+			} `json:"target"`
+		} `json:"events"`
+	}
+	if err := json.Unmarshal(body, &notification); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse docker registry notification as json")
+	}
+
+	for _, event := range notification.Events {
+		if event.Action != "push" || event.Target.Tag == "" {
+			continue
+		}
+
+		// Only decode the body a second time (for the optional
+		// RefTypeJSONPath/CommitSHAJSONPath/TemplateVarsJSONPath selectors)
+		// once a push event is actually found — the common "nothing to run"
+		// case above stays a single decode.
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return nil, errors.Wrapf(err, "failed to parse event body as json")
+		}
+		return parseJSONPathDocWithDefaultRef(doc, rule, "tag", event.Target.Tag, event.Target.Digest)
+	}
+
+	return nil, errors.Errorf("docker registry notification has no push event with a target tag, and rule %q has no RefJSONPath override", rule.Name)
+}
+
+// containerRegistryEventAdapter understands the push event shape shared by
+// most OCI-compatible registry webhooks (GCR/ECR/Harbor/GHCR): a flat
+// "action"/"tag"/"digest" object, rather than Docker Registry's nested
+// "events" array. Only "push" actions produce a ref; anything else (e.g. a
+// delete) is treated as nothing to run, same as a generic rule with no
+// match would be. As with dockerRegistryEventAdapter, a rule that doesn't
+// override RefJSONPath still gets its RefTypeJSONPath/CommitSHAJSONPath/
+// TemplateVarsJSONPath selectors evaluated against the payload.
+type containerRegistryEventAdapter struct{}
+
+func (a *containerRegistryEventAdapter) Verify(r *http.Request, body []byte, rule *cstypes.TriggerRule) error {
+	return verifySignature(r, body, rule)
+}
+
+func (a *containerRegistryEventAdapter) Parse(body []byte, rule *cstypes.TriggerRule) (*ParsedEvent, error) {
+	if rule.RefJSONPath != "" {
+		return parseWithJSONPath(body, rule)
+	}
+
+	var event struct {
+		Action string `json:"action"`
+		Tag    string `json:"tag"`
+		Digest string `json:"digest"`
+	}
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse container registry event as json")
+	}
+	if event.Action != "" && event.Action != "push" {
+		return nil, errors.Errorf("container registry event action %q doesn't trigger a run", event.Action)
+	}
+	if event.Tag == "" {
+		return nil, errors.Errorf("container registry event has no tag, and rule %q has no RefJSONPath override", rule.Name)
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse event body as json")
+	}
+	return parseJSONPathDocWithDefaultRef(doc, rule, "tag", event.Tag, event.Digest)
+}
+
+// cloudEventsEventAdapter unwraps a CloudEvents structured-mode envelope
+// (https://github.com/cloudevents/spec, structured HTTP content mode): the
+// event's own payload lives under the envelope's "data" field, alongside
+// context attributes like "specversion"/"type"/"source" that aren't part of
+// the payload rule selectors should run against. In binary mode those
+// context attributes travel as ce-* headers instead and the body already is
+// the payload, so there's nothing to unwrap; Parse only sees the body, so it
+// detects structured mode by the presence of "specversion" at the top level.
+type cloudEventsEventAdapter struct{}
+
+func (a *cloudEventsEventAdapter) Verify(r *http.Request, body []byte, rule *cstypes.TriggerRule) error {
+	return verifySignature(r, body, rule)
+}
+
+func (a *cloudEventsEventAdapter) Parse(body []byte, rule *cstypes.TriggerRule) (*ParsedEvent, error) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse event body as json")
+	}
+
+	// Only a JSON object can be a structured-mode envelope; a binary-mode
+	// payload (or a structured payload that happens to be an array/scalar)
+	// is used as-is.
+	if envelope, ok := doc.(map[string]interface{}); ok {
+		if _, structuredMode := envelope["specversion"]; structuredMode {
+			if data, ok := envelope["data"]; ok {
+				doc = data
+			}
+		}
+	}
+
+	return parseJSONPathDoc(doc, rule)
+}
+
+// verifySignature checks the request against rule's configured signature
+// scheme, skipping verification when the scheme is none.
+func verifySignature(r *http.Request, body []byte, rule *cstypes.TriggerRule) error {
+	switch rule.SignatureScheme {
+	case cstypes.SignatureSchemeNone, "":
+		return nil
+	case cstypes.SignatureSchemeHMACSHA256:
+		header := r.Header.Get(rule.SignatureHeader)
+		if header == "" {
+			return errors.Errorf("missing signature header %q", rule.SignatureHeader)
+		}
+		return verifyHMACSHA256(header, body, rule.SignatureSecret)
+	case cstypes.SignatureSchemeSharedKey:
+		header := r.Header.Get(rule.SignatureHeader)
+		if header == "" {
+			return errors.Errorf("missing signature header %q", rule.SignatureHeader)
+		}
+		if !hmac.Equal([]byte(header), []byte(rule.SignatureSecret)) {
+			return errors.Errorf("shared key in header %q doesn't match", rule.SignatureHeader)
+		}
+		return nil
+	default:
+		return errors.Errorf("unknown signature scheme %q", rule.SignatureScheme)
+	}
+}
+
+// verifyHMACSHA256 checks header against the HMAC-SHA256 of body keyed with
+// secret, hex encoded and optionally prefixed with "sha256=" (the convention
+// used by GitHub/Docker-style webhook signatures).
+func verifyHMACSHA256(header string, body []byte, secret string) error {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	got := strings.TrimPrefix(header, "sha256=")
+	if !hmac.Equal([]byte(got), []byte(expected)) {
+		return errors.Errorf("hmac-sha256 signature mismatch")
+	}
+
+	return nil
+}
+
+// parseWithJSONPath applies rule's JSONPath selectors to body to build a
+// ParsedEvent. It's shared by every adapter since, once verified, they all
+// reduce to "run these selectors over this JSON document".
+func parseWithJSONPath(body []byte, rule *cstypes.TriggerRule) (*ParsedEvent, error) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse event body as json")
+	}
+
+	return parseJSONPathDoc(doc, rule)
+}
+
+// parseJSONPathDoc is parseWithJSONPath's selector logic, taking an
+// already-decoded document instead of raw bytes so adapters that need to
+// unwrap an envelope first (cloudEventsEventAdapter) can select the right
+// sub-document before the selectors run.
+func parseJSONPathDoc(doc interface{}, rule *cstypes.TriggerRule) (*ParsedEvent, error) {
+	if rule.RefJSONPath == "" {
+		return nil, errors.Errorf("trigger rule %q has no ref jsonpath configured", rule.Name)
+	}
+
+	ref, err := jsonPathString(doc, rule.RefJSONPath, true)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to extract ref")
+	}
+
+	refType, commitSHA, templateVars, err := parseJSONPathOptionalFields(doc, rule)
+	if err != nil {
+		return nil, err
+	}
+	if refType == "" {
+		refType = "branch"
+	}
+
+	return &ParsedEvent{
+		RefType:      types.RunRefType(refType),
+		Ref:          ref,
+		CommitSHA:    commitSHA,
+		TemplateVars: templateVars,
+	}, nil
+}
+
+// parseJSONPathDocWithDefaultRef behaves like parseJSONPathDoc, except that
+// when rule.RefJSONPath is empty it falls back to defaultRef/defaultRefType/
+// defaultCommitSHA instead of erroring. It's for adapters whose payload
+// shape implies a sensible ref on its own (dockerRegistryEventAdapter,
+// containerRegistryEventAdapter's pushed tag) — a rule only needs
+// RefJSONPath to override that default, the same way it would to override
+// anything else; RefTypeJSONPath/CommitSHAJSONPath/TemplateVarsJSONPath, if
+// configured, still run against doc exactly as they would for any other
+// adapter rather than being silently skipped alongside the ref default.
+func parseJSONPathDocWithDefaultRef(doc interface{}, rule *cstypes.TriggerRule, defaultRefType types.RunRefType, defaultRef, defaultCommitSHA string) (*ParsedEvent, error) {
+	if rule.RefJSONPath != "" {
+		return parseJSONPathDoc(doc, rule)
+	}
+
+	refType, commitSHA, templateVars, err := parseJSONPathOptionalFields(doc, rule)
+	if err != nil {
+		return nil, err
+	}
+	if refType == "" {
+		refType = string(defaultRefType)
+	}
+	if commitSHA == "" {
+		commitSHA = defaultCommitSHA
+	}
+
+	return &ParsedEvent{
+		RefType:      types.RunRefType(refType),
+		Ref:          defaultRef,
+		CommitSHA:    commitSHA,
+		TemplateVars: templateVars,
+	}, nil
+}
+
+// parseJSONPathOptionalFields extracts the ref type, commit sha and template
+// vars rule configures JSONPath selectors for — every ParsedEvent field
+// except Ref, which parseJSONPathDoc and parseJSONPathDocWithDefaultRef
+// source differently (a required selector vs. an adapter-specific default).
+func parseJSONPathOptionalFields(doc interface{}, rule *cstypes.TriggerRule) (refType, commitSHA string, templateVars map[string]string, err error) {
+	refType, err = jsonPathString(doc, rule.RefTypeJSONPath, false)
+	if err != nil {
+		return "", "", nil, errors.Wrapf(err, "failed to extract ref type")
+	}
+
+	commitSHA, err = jsonPathString(doc, rule.CommitSHAJSONPath, false)
+	if err != nil {
+		return "", "", nil, errors.Wrapf(err, "failed to extract commit sha")
+	}
+
+	templateVars = make(map[string]string, len(rule.TemplateVarsJSONPath))
+	for name, path := range rule.TemplateVarsJSONPath {
+		v, err := jsonPathString(doc, path, false)
+		if err != nil {
+			return "", "", nil, errors.Wrapf(err, "failed to extract template var %q", name)
+		}
+		templateVars[name] = v
+	}
+
+	return refType, commitSHA, templateVars, nil
+}
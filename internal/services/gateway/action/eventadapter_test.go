@@ -0,0 +1,237 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+func TestParseWithJSONPath(t *testing.T) {
+	body := []byte(`{"push_data":{"tag":"v1.2.3"},"repository":{"commit_sha":"abc123"},"meta":{"env":"prod"}}`)
+
+	rule := &cstypes.TriggerRule{
+		Name:                 "test",
+		RefJSONPath:          "push_data.tag",
+		CommitSHAJSONPath:    "repository.commit_sha",
+		TemplateVarsJSONPath: map[string]string{"env": "meta.env"},
+	}
+
+	parsed, err := parseWithJSONPath(body, rule)
+	if err != nil {
+		t.Fatalf("parseWithJSONPath() error = %v", err)
+	}
+	if parsed.Ref != "v1.2.3" {
+		t.Errorf("Ref = %q, want v1.2.3", parsed.Ref)
+	}
+	if parsed.CommitSHA != "abc123" {
+		t.Errorf("CommitSHA = %q, want abc123", parsed.CommitSHA)
+	}
+	if parsed.TemplateVars["env"] != "prod" {
+		t.Errorf("TemplateVars[env] = %q, want prod", parsed.TemplateVars["env"])
+	}
+}
+
+func TestParseWithJSONPathMissingRef(t *testing.T) {
+	rule := &cstypes.TriggerRule{Name: "test", RefJSONPath: "push_data.tag"}
+
+	if _, err := parseWithJSONPath([]byte(`{"other":"value"}`), rule); err == nil {
+		t.Fatal("parseWithJSONPath() expected error for missing ref path, got nil")
+	}
+}
+
+func TestVerifySignatureHMACSHA256(t *testing.T) {
+	body := []byte(`{"ref":"main"}`)
+	secret := "s3cr3t"
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	sig := hex.EncodeToString(mac.Sum(nil))
+
+	rule := &cstypes.TriggerRule{
+		SignatureScheme: cstypes.SignatureSchemeHMACSHA256,
+		SignatureHeader: "X-Signature",
+		SignatureSecret: secret,
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("X-Signature", "sha256="+sig)
+
+	if err := verifySignature(req, body, rule); err != nil {
+		t.Fatalf("verifySignature() error = %v", err)
+	}
+}
+
+func TestDockerRegistryEventAdapterParseDefaultsRefToTag(t *testing.T) {
+	body := []byte(`{"events":[{"action":"push","target":{"tag":"v1.2.3","digest":"sha256:abc"}}]}`)
+	rule := &cstypes.TriggerRule{Name: "test"}
+
+	parsed, err := (&dockerRegistryEventAdapter{}).Parse(body, rule)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if parsed.Ref != "v1.2.3" {
+		t.Errorf("Ref = %q, want v1.2.3", parsed.Ref)
+	}
+	if parsed.CommitSHA != "sha256:abc" {
+		t.Errorf("CommitSHA = %q, want sha256:abc", parsed.CommitSHA)
+	}
+}
+
+func TestDockerRegistryEventAdapterParseDefaultRefStillAppliesOptionalSelectors(t *testing.T) {
+	body := []byte(`{"events":[{"action":"push","target":{"tag":"v1.2.3","digest":"sha256:abc"}}],"meta":{"env":"prod"}}`)
+	rule := &cstypes.TriggerRule{
+		Name:                 "test",
+		TemplateVarsJSONPath: map[string]string{"env": "meta.env"},
+	}
+
+	parsed, err := (&dockerRegistryEventAdapter{}).Parse(body, rule)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if parsed.Ref != "v1.2.3" {
+		t.Errorf("Ref = %q, want v1.2.3 (the struct-parsed default)", parsed.Ref)
+	}
+	if parsed.TemplateVars["env"] != "prod" {
+		t.Errorf("TemplateVars[env] = %q, want prod (the rule's selector, still honored alongside the default ref)", parsed.TemplateVars["env"])
+	}
+}
+
+func TestDockerRegistryEventAdapterParseSkipsNonPushEvents(t *testing.T) {
+	body := []byte(`{"events":[{"action":"pull","target":{"tag":"v1.0.0"}},{"action":"push","target":{"tag":"v1.2.3","digest":"sha256:abc"}}]}`)
+	rule := &cstypes.TriggerRule{Name: "test"}
+
+	parsed, err := (&dockerRegistryEventAdapter{}).Parse(body, rule)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if parsed.Ref != "v1.2.3" {
+		t.Errorf("Ref = %q, want v1.2.3 (the push event, not the preceding pull)", parsed.Ref)
+	}
+}
+
+func TestDockerRegistryEventAdapterParseNoEvents(t *testing.T) {
+	rule := &cstypes.TriggerRule{Name: "test"}
+
+	if _, err := (&dockerRegistryEventAdapter{}).Parse([]byte(`{"events":[]}`), rule); err == nil {
+		t.Fatal("Parse() expected error for notification with no events, got nil")
+	}
+}
+
+func TestDockerRegistryEventAdapterParseNoPushEvent(t *testing.T) {
+	rule := &cstypes.TriggerRule{Name: "test"}
+
+	if _, err := (&dockerRegistryEventAdapter{}).Parse([]byte(`{"events":[{"action":"pull","target":{"tag":"v1.0.0"}}]}`), rule); err == nil {
+		t.Fatal("Parse() expected error when no event has a push action, got nil")
+	}
+}
+
+func TestContainerRegistryEventAdapterParseDefaultsRefToTag(t *testing.T) {
+	body := []byte(`{"action":"push","tag":"v2.0.0","digest":"sha256:def"}`)
+	rule := &cstypes.TriggerRule{Name: "test"}
+
+	parsed, err := (&containerRegistryEventAdapter{}).Parse(body, rule)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if parsed.Ref != "v2.0.0" {
+		t.Errorf("Ref = %q, want v2.0.0", parsed.Ref)
+	}
+}
+
+func TestContainerRegistryEventAdapterParseIgnoresNonPushAction(t *testing.T) {
+	body := []byte(`{"action":"delete","tag":"v2.0.0"}`)
+	rule := &cstypes.TriggerRule{Name: "test"}
+
+	if _, err := (&containerRegistryEventAdapter{}).Parse(body, rule); err == nil {
+		t.Fatal("Parse() expected error for non-push action, got nil")
+	}
+}
+
+func TestCloudEventsEventAdapterParseStructuredModeUnwrapsData(t *testing.T) {
+	body := []byte(`{"specversion":"1.0","type":"com.example.push","source":"/example","data":{"ref":"main","commit_sha":"abc123"}}`)
+	rule := &cstypes.TriggerRule{
+		Name:              "test",
+		RefJSONPath:       "ref",
+		CommitSHAJSONPath: "commit_sha",
+	}
+
+	parsed, err := (&cloudEventsEventAdapter{}).Parse(body, rule)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if parsed.Ref != "main" {
+		t.Errorf("Ref = %q, want main", parsed.Ref)
+	}
+	if parsed.CommitSHA != "abc123" {
+		t.Errorf("CommitSHA = %q, want abc123", parsed.CommitSHA)
+	}
+}
+
+func TestCloudEventsEventAdapterParseBinaryModeUsesBodyDirectly(t *testing.T) {
+	body := []byte(`{"ref":"main","commit_sha":"abc123"}`)
+	rule := &cstypes.TriggerRule{
+		Name:              "test",
+		RefJSONPath:       "ref",
+		CommitSHAJSONPath: "commit_sha",
+	}
+
+	parsed, err := (&cloudEventsEventAdapter{}).Parse(body, rule)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if parsed.Ref != "main" {
+		t.Errorf("Ref = %q, want main", parsed.Ref)
+	}
+}
+
+func TestCloudEventsEventAdapterParseBinaryModeArrayBody(t *testing.T) {
+	body := []byte(`[{"ref":"main"}]`)
+	rule := &cstypes.TriggerRule{
+		Name:        "test",
+		RefJSONPath: "[0].ref",
+	}
+
+	parsed, err := (&cloudEventsEventAdapter{}).Parse(body, rule)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if parsed.Ref != "main" {
+		t.Errorf("Ref = %q, want main", parsed.Ref)
+	}
+}
+
+func TestVerifySignatureHMACSHA256Mismatch(t *testing.T) {
+	body := []byte(`{"ref":"main"}`)
+	rule := &cstypes.TriggerRule{
+		SignatureScheme: cstypes.SignatureSchemeHMACSHA256,
+		SignatureHeader: "X-Signature",
+		SignatureSecret: "s3cr3t",
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+	req.Header.Set("X-Signature", "sha256=deadbeef")
+
+	if err := verifySignature(req, body, rule); err == nil {
+		t.Fatal("verifySignature() expected error for mismatched signature, got nil")
+	}
+}
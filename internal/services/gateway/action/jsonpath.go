@@ -0,0 +1,137 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/sorintlab/errors"
+)
+
+// lookupJSONPath walks doc (the result of json.Unmarshal into interface{})
+// following a dot-separated path of object keys and [n] array indexes, e.g.
+// "push_data.tag" or "events[0].target.tag". A leading "$." or "$" is
+// accepted and stripped, matching the common JSONPath convention. It returns
+// an error instead of panicking whenever the path doesn't match the
+// document's actual shape.
+func lookupJSONPath(doc interface{}, path string) (interface{}, error) {
+	path = strings.TrimPrefix(path, "$.")
+	path = strings.TrimPrefix(path, "$")
+	if path == "" {
+		return doc, nil
+	}
+
+	cur := doc
+	for _, rawSeg := range strings.Split(path, ".") {
+		if rawSeg == "" {
+			continue
+		}
+
+		key, indexes, err := splitSegment(rawSeg)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid jsonpath segment %q in %q", rawSeg, path)
+		}
+
+		if key != "" {
+			m, ok := cur.(map[string]interface{})
+			if !ok {
+				return nil, errors.Errorf("jsonpath %q: expected object to read field %q", path, key)
+			}
+			v, ok := m[key]
+			if !ok {
+				return nil, errors.Errorf("jsonpath %q: field %q not found", path, key)
+			}
+			cur = v
+		}
+
+		for _, idx := range indexes {
+			a, ok := cur.([]interface{})
+			if !ok {
+				return nil, errors.Errorf("jsonpath %q: expected array to index [%d]", path, idx)
+			}
+			if idx < 0 || idx >= len(a) {
+				return nil, errors.Errorf("jsonpath %q: index [%d] out of range (len %d)", path, idx, len(a))
+			}
+			cur = a[idx]
+		}
+	}
+
+	return cur, nil
+}
+
+// splitSegment splits a path segment like "target[0][1]" into its object key
+// ("target") and its array indexes ([0, 1]), in order. key is empty when the
+// segment starts directly with an index, e.g. "[0]".
+func splitSegment(seg string) (string, []int, error) {
+	bracket := strings.IndexByte(seg, '[')
+	if bracket == -1 {
+		return seg, nil, nil
+	}
+
+	key := seg[:bracket]
+	rest := seg[bracket:]
+
+	var indexes []int
+	for rest != "" {
+		if !strings.HasPrefix(rest, "[") {
+			return "", nil, errors.Errorf("malformed index in segment %q", seg)
+		}
+		end := strings.IndexByte(rest, ']')
+		if end == -1 {
+			return "", nil, errors.Errorf("unterminated index in segment %q", seg)
+		}
+		idx, err := strconv.Atoi(rest[1:end])
+		if err != nil {
+			return "", nil, errors.Wrapf(err, "non-numeric index in segment %q", seg)
+		}
+		indexes = append(indexes, idx)
+		rest = rest[end+1:]
+	}
+
+	return key, indexes, nil
+}
+
+// jsonPathString is a convenience wrapper around lookupJSONPath for the
+// common case of extracting a string value, tolerating a missing optional
+// path by returning the zero value instead of an error.
+func jsonPathString(doc interface{}, path string, required bool) (string, error) {
+	if path == "" {
+		if required {
+			return "", errors.Errorf("jsonpath not configured")
+		}
+		return "", nil
+	}
+
+	v, err := lookupJSONPath(doc, path)
+	if err != nil {
+		if required {
+			return "", err
+		}
+		return "", nil
+	}
+
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case nil:
+		if required {
+			return "", errors.Errorf("jsonpath %q resolved to null", path)
+		}
+		return "", nil
+	default:
+		return "", errors.Errorf("jsonpath %q: expected a string value", path)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	"agola.io/agola/internal/util"
+)
+
+// RotateKEK asks configstore to re-wrap every secret's DEK under the KMS
+// provider staged there for rotation, which then becomes the current one.
+// Secret data is never decrypted to do this: only
+// the (tiny) wrapped DEK is unwrapped with the old KEK and wrapped again
+// with the new one.
+func (h *ActionHandler) RotateKEK(ctx context.Context) error {
+	if !h.IsUserAdmin(ctx) {
+		return util.NewAPIError(util.ErrForbidden, util.WithAPIErrorMsg("user not authorized"))
+	}
+
+	h.log.Info().Msg("rotating kek")
+	if _, err := h.configstoreClient.RotateKEK(ctx); err != nil {
+		return APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to rotate kek"))
+	}
+	h.log.Info().Msg("kek rotation complete")
+
+	return nil
+}
@@ -84,10 +84,33 @@ func (h *ActionHandler) CreateSecret(ctx context.Context, req *CreateSecretReque
 		return nil, util.NewAPIError(util.ErrBadRequest, util.WithAPIErrorMsgf("invalid secret name %q", req.Name), serrors.InvalidSecretName())
 	}
 
+	if req.Type == cstypes.SecretTypeExternal && req.SecretProviderID == "" {
+		return nil, util.NewAPIError(util.ErrBadRequest, util.WithAPIErrorMsg("external secret requires a secret provider id"))
+	}
+
 	creq := &csapitypes.CreateUpdateSecretRequest{
 		Name: req.Name,
 		Type: req.Type,
 		Data: req.Data,
+
+		SecretProviderID: req.SecretProviderID,
+		Path:             req.Path,
+	}
+
+	// Internal secrets are encrypted before creq ever reaches configstore:
+	// req.Data is swapped for the ciphertext so the persisted record (and
+	// everything on the wire past this point) carries Encrypted instead of
+	// plaintext Data. There's no secret ID yet to key the encryption on, so
+	// EncryptSecretData is keyed on the secret's (parent, name) path instead,
+	// which is known up front and stable for as long as the name doesn't
+	// change (see UpdateSecret).
+	if req.Type != cstypes.SecretTypeExternal && len(req.Data) > 0 {
+		enc, _, err := h.configstoreClient.EncryptSecretData(ctx, secretEncryptionKey(req.ParentType, req.ParentRef, req.Name), "", req.Data)
+		if err != nil {
+			return nil, APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to encrypt secret data"))
+		}
+		creq.Data = nil
+		creq.Encrypted = enc
 	}
 
 	var rs *csapitypes.Secret
@@ -102,6 +125,15 @@ func (h *ActionHandler) CreateSecret(ctx context.Context, req *CreateSecretReque
 	if err != nil {
 		return nil, APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to create secret"))
 	}
+	if req.Type == cstypes.SecretTypeExternal {
+		h.log.Info().Msgf("external secret %s created, ID: %s, provider: %s, path: %s", rs.Name, rs.ID, req.SecretProviderID, req.Path)
+	} else if creq.Encrypted != nil {
+		// Defensive: make sure the response never carries plaintext Data even
+		// if whatever's behind CreateProjectSecret/CreateProjectGroupSecret
+		// doesn't echo Encrypted back on its own.
+		rs.Encrypted = creq.Encrypted
+		rs.Secret = nil
+	}
 	h.log.Info().Msgf("secret %s created, ID: %s", rs.Name, rs.ID)
 
 	return rs, nil
@@ -138,10 +170,36 @@ func (h *ActionHandler) UpdateSecret(ctx context.Context, req *UpdateSecretReque
 		return nil, util.NewAPIError(util.ErrBadRequest, util.WithAPIErrorMsgf("invalid secret name %q", req.Name), serrors.InvalidSecretName())
 	}
 
+	if req.Type == cstypes.SecretTypeExternal && req.SecretProviderID == "" {
+		return nil, util.NewAPIError(util.ErrBadRequest, util.WithAPIErrorMsg("external secret requires a secret provider id"))
+	}
+
 	creq := &csapitypes.CreateUpdateSecretRequest{
 		Name: req.Name,
 		Type: req.Type,
 		Data: req.Data,
+
+		SecretProviderID: req.SecretProviderID,
+		Path:             req.Path,
+	}
+
+	// Same reordering as CreateSecret: encrypt before the update is sent, keyed
+	// on the secret's new path. When the update also renames the secret
+	// (req.Name != req.SecretName), the old path is passed through too so the
+	// command handler migrates the encryption-tracking entry instead of
+	// orphaning it under the pre-rename key.
+	if req.Type != cstypes.SecretTypeExternal && len(req.Data) > 0 {
+		key := secretEncryptionKey(req.ParentType, req.ParentRef, req.Name)
+		oldKey := ""
+		if req.Name != req.SecretName {
+			oldKey = secretEncryptionKey(req.ParentType, req.ParentRef, req.SecretName)
+		}
+		enc, _, err := h.configstoreClient.EncryptSecretData(ctx, key, oldKey, req.Data)
+		if err != nil {
+			return nil, APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to encrypt secret data"))
+		}
+		creq.Data = nil
+		creq.Encrypted = enc
 	}
 
 	var rs *csapitypes.Secret
@@ -156,11 +214,25 @@ func (h *ActionHandler) UpdateSecret(ctx context.Context, req *UpdateSecretReque
 	if err != nil {
 		return nil, APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to update secret"))
 	}
+	if req.Type == cstypes.SecretTypeExternal {
+		h.log.Info().Msgf("external secret %s updated, ID: %s, provider: %s, path: %s", rs.Name, rs.ID, req.SecretProviderID, req.Path)
+	} else if creq.Encrypted != nil {
+		rs.Encrypted = creq.Encrypted
+		rs.Secret = nil
+	}
 	h.log.Info().Msgf("secret %s updated, ID: %s", rs.Name, rs.ID)
 
 	return rs, nil
 }
 
+// secretEncryptionKey identifies a secret for envelope-encryption purposes
+// before it has a configstore-assigned ID: its parent and name together are
+// stable and known to the caller up front, unlike the ID which configstore
+// only assigns once the record is created.
+func secretEncryptionKey(parentType cstypes.ObjectKind, parentRef, name string) string {
+	return string(parentType) + "/" + parentRef + "/" + name
+}
+
 func (h *ActionHandler) DeleteSecret(ctx context.Context, parentType cstypes.ObjectKind, parentRef, name string) error {
 	isVariableOwner, err := h.IsAuthUserVariableOwner(ctx, parentType, parentRef)
 	if err != nil {
@@ -0,0 +1,130 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	"agola.io/agola/internal/util"
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+// secret providers are a global resource, like remote sources, so only an
+// admin can manage them.
+
+func (h *ActionHandler) GetSecretProviders(ctx context.Context) ([]*csapitypes.SecretProvider, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewAPIError(util.ErrForbidden, util.WithAPIErrorMsg("user not authorized"))
+	}
+
+	sps, _, err := h.configstoreClient.GetSecretProviders(ctx)
+	if err != nil {
+		return nil, APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to get secret providers"))
+	}
+
+	return sps, nil
+}
+
+type CreateSecretProviderRequest struct {
+	Name string
+	Type cstypes.SecretProviderType
+
+	Vault *cstypes.VaultConfig
+	AWSSM *cstypes.AWSSMConfig
+	GCPSM *cstypes.GCPSMConfig
+	K8s   *cstypes.K8sConfig
+}
+
+func (h *ActionHandler) CreateSecretProvider(ctx context.Context, req *CreateSecretProviderRequest) (*csapitypes.SecretProvider, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewAPIError(util.ErrForbidden, util.WithAPIErrorMsg("user not authorized"))
+	}
+
+	if !util.ValidateName(req.Name) {
+		return nil, util.NewAPIError(util.ErrBadRequest, util.WithAPIErrorMsgf("invalid secret provider name %q", req.Name))
+	}
+
+	creq := &csapitypes.CreateUpdateSecretProviderRequest{
+		Name:  req.Name,
+		Type:  req.Type,
+		Vault: req.Vault,
+		AWSSM: req.AWSSM,
+		GCPSM: req.GCPSM,
+		K8s:   req.K8s,
+	}
+
+	h.log.Info().Msg("creating secret provider")
+	sp, _, err := h.configstoreClient.CreateSecretProvider(ctx, creq)
+	if err != nil {
+		return nil, APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to create secret provider"))
+	}
+	h.log.Info().Msgf("secret provider %s created, ID: %s", sp.Name, sp.ID)
+
+	return sp, nil
+}
+
+type UpdateSecretProviderRequest struct {
+	SecretProviderName string
+
+	Name string
+	Type cstypes.SecretProviderType
+
+	Vault *cstypes.VaultConfig
+	AWSSM *cstypes.AWSSMConfig
+	GCPSM *cstypes.GCPSMConfig
+	K8s   *cstypes.K8sConfig
+}
+
+func (h *ActionHandler) UpdateSecretProvider(ctx context.Context, req *UpdateSecretProviderRequest) (*csapitypes.SecretProvider, error) {
+	if !h.IsUserAdmin(ctx) {
+		return nil, util.NewAPIError(util.ErrForbidden, util.WithAPIErrorMsg("user not authorized"))
+	}
+
+	if !util.ValidateName(req.Name) {
+		return nil, util.NewAPIError(util.ErrBadRequest, util.WithAPIErrorMsgf("invalid secret provider name %q", req.Name))
+	}
+
+	creq := &csapitypes.CreateUpdateSecretProviderRequest{
+		Name:  req.Name,
+		Type:  req.Type,
+		Vault: req.Vault,
+		AWSSM: req.AWSSM,
+		GCPSM: req.GCPSM,
+		K8s:   req.K8s,
+	}
+
+	h.log.Info().Msg("updating secret provider")
+	sp, _, err := h.configstoreClient.UpdateSecretProvider(ctx, req.SecretProviderName, creq)
+	if err != nil {
+		return nil, APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to update secret provider"))
+	}
+	h.log.Info().Msgf("secret provider %s updated, ID: %s", sp.Name, sp.ID)
+
+	return sp, nil
+}
+
+func (h *ActionHandler) DeleteSecretProvider(ctx context.Context, name string) error {
+	if !h.IsUserAdmin(ctx) {
+		return util.NewAPIError(util.ErrForbidden, util.WithAPIErrorMsg("user not authorized"))
+	}
+
+	h.log.Info().Msg("deleting secret provider")
+	if _, err := h.configstoreClient.DeleteSecretProvider(ctx, name); err != nil {
+		return APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to delete secret provider"))
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+
+	"agola.io/agola/internal/util"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+func (h *ActionHandler) GetProjectTriggerRules(ctx context.Context, projectRef string) ([]*cstypes.TriggerRule, error) {
+	isVariableOwner, err := h.IsAuthUserVariableOwner(ctx, cstypes.ObjectKindProject, projectRef)
+	if err != nil {
+		return nil, err
+	}
+	if !isVariableOwner {
+		return nil, util.NewAPIError(util.ErrForbidden, util.WithAPIErrorMsg("user not authorized"))
+	}
+
+	rules, _, err := h.configstoreClient.GetProjectTriggerRules(ctx, projectRef)
+	if err != nil {
+		return nil, APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to get project trigger rules"))
+	}
+
+	return rules, nil
+}
+
+type CreateTriggerRuleRequest struct {
+	ProjectRef string
+
+	Name        string
+	AdapterType cstypes.EventAdapterType
+
+	SignatureScheme SignatureSchemeRequest
+	RefJSONPath     string
+	RefTypeJSONPath string
+
+	CommitSHAJSONPath    string
+	TemplateVarsJSONPath map[string]string
+}
+
+type SignatureSchemeRequest struct {
+	Scheme cstypes.SignatureScheme
+	Header string
+	Secret string
+}
+
+func (h *ActionHandler) CreateProjectTriggerRule(ctx context.Context, req *CreateTriggerRuleRequest) (*cstypes.TriggerRule, error) {
+	isVariableOwner, err := h.IsAuthUserVariableOwner(ctx, cstypes.ObjectKindProject, req.ProjectRef)
+	if err != nil {
+		return nil, err
+	}
+	if !isVariableOwner {
+		return nil, util.NewAPIError(util.ErrForbidden, util.WithAPIErrorMsg("user not authorized"))
+	}
+
+	if !util.ValidateName(req.Name) {
+		return nil, util.NewAPIError(util.ErrBadRequest, util.WithAPIErrorMsgf("invalid trigger rule name %q", req.Name))
+	}
+	// The registry adapters default the ref to the pushed tag when no
+	// RefJSONPath is set; every other adapter needs one.
+	refJSONPathOptional := req.AdapterType == cstypes.EventAdapterTypeDockerRegistry || req.AdapterType == cstypes.EventAdapterTypeContainerRegistry
+	if req.RefJSONPath == "" && !refJSONPathOptional {
+		return nil, util.NewAPIError(util.ErrBadRequest, util.WithAPIErrorMsg("trigger rule requires a ref jsonpath"))
+	}
+
+	creq := &cstypes.TriggerRule{
+		Name:                 req.Name,
+		AdapterType:          req.AdapterType,
+		SignatureScheme:      req.SignatureScheme.Scheme,
+		SignatureHeader:      req.SignatureScheme.Header,
+		SignatureSecret:      req.SignatureScheme.Secret,
+		RefJSONPath:          req.RefJSONPath,
+		RefTypeJSONPath:      req.RefTypeJSONPath,
+		CommitSHAJSONPath:    req.CommitSHAJSONPath,
+		TemplateVarsJSONPath: req.TemplateVarsJSONPath,
+	}
+
+	h.log.Info().Msg("creating project trigger rule")
+	rule, _, err := h.configstoreClient.CreateProjectTriggerRule(ctx, req.ProjectRef, creq)
+	if err != nil {
+		return nil, APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to create trigger rule"))
+	}
+	h.log.Info().Msgf("trigger rule %s created, ID: %s", rule.Name, rule.ID)
+
+	return rule, nil
+}
+
+func (h *ActionHandler) DeleteProjectTriggerRule(ctx context.Context, projectRef, name string) error {
+	isVariableOwner, err := h.IsAuthUserVariableOwner(ctx, cstypes.ObjectKindProject, projectRef)
+	if err != nil {
+		return err
+	}
+	if !isVariableOwner {
+		return util.NewAPIError(util.ErrForbidden, util.WithAPIErrorMsg("user not authorized"))
+	}
+
+	h.log.Info().Msg("deleting project trigger rule")
+	if _, err := h.configstoreClient.DeleteProjectTriggerRule(ctx, projectRef, name); err != nil {
+		return APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to delete trigger rule"))
+	}
+
+	return nil
+}
@@ -0,0 +1,238 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"agola.io/agola/internal/util"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+// maxWebhookDeliveryAttempts bounds the retry/backoff loop before a delivery
+// is moved to the dead-letter state and requires a manual replay.
+const maxWebhookDeliveryAttempts = 5
+
+// webhookDeliveryBackoffBase and webhookDeliveryBackoffMax bound the
+// exponential backoff applied between retry attempts: 30s, 1m, 2m, 4m, ...
+// capped at 30m, so a flaky downstream doesn't get hammered by the worker.
+const (
+	webhookDeliveryBackoffBase = 30 * time.Second
+	webhookDeliveryBackoffMax  = 30 * time.Minute
+)
+
+// webhookDeliveryBackoff returns how long to wait after the attempt-th
+// failed attempt (1-indexed) before the delivery is retried again.
+func webhookDeliveryBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return 0
+	}
+
+	d := webhookDeliveryBackoffBase
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= webhookDeliveryBackoffMax {
+			return webhookDeliveryBackoffMax
+		}
+	}
+
+	return d
+}
+
+type GetWebhookDeliveriesRequest struct {
+	ProjectRef string
+
+	// State, when set, restricts the listing to deliveries in that state
+	// (e.g. "deadletter" for the DLQ view).
+	State cstypes.WebhookDeliveryState
+}
+
+func (h *ActionHandler) GetWebhookDeliveries(ctx context.Context, req *GetWebhookDeliveriesRequest) ([]*cstypes.WebhookDelivery, error) {
+	isVariableOwner, err := h.IsAuthUserVariableOwner(ctx, cstypes.ObjectKindProject, req.ProjectRef)
+	if err != nil {
+		return nil, err
+	}
+	if !isVariableOwner {
+		return nil, util.NewAPIError(util.ErrForbidden, util.WithAPIErrorMsg("user not authorized"))
+	}
+
+	deliveries, _, err := h.configstoreClient.GetProjectWebhookDeliveries(ctx, req.ProjectRef, req.State)
+	if err != nil {
+		return nil, APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to get webhook deliveries"))
+	}
+
+	return deliveries, nil
+}
+
+func (h *ActionHandler) GetWebhookDelivery(ctx context.Context, projectRef, deliveryID string) (*cstypes.WebhookDelivery, error) {
+	isVariableOwner, err := h.IsAuthUserVariableOwner(ctx, cstypes.ObjectKindProject, projectRef)
+	if err != nil {
+		return nil, err
+	}
+	if !isVariableOwner {
+		return nil, util.NewAPIError(util.ErrForbidden, util.WithAPIErrorMsg("user not authorized"))
+	}
+
+	delivery, _, err := h.configstoreClient.GetProjectWebhookDelivery(ctx, projectRef, deliveryID)
+	if err != nil {
+		return nil, APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to get webhook delivery"))
+	}
+
+	return delivery, nil
+}
+
+// ReplayWebhookDelivery reprocesses a previously persisted delivery, as if
+// it had just been received, and is how a webhook stuck in the failed or
+// deadletter state is retried after whatever made it fail (a down
+// configstore, a bad project config) is fixed.
+func (h *ActionHandler) ReplayWebhookDelivery(ctx context.Context, projectRef, deliveryID string, process func(ctx context.Context, delivery *cstypes.WebhookDelivery) error) error {
+	isVariableOwner, err := h.IsAuthUserVariableOwner(ctx, cstypes.ObjectKindProject, projectRef)
+	if err != nil {
+		return err
+	}
+	if !isVariableOwner {
+		return util.NewAPIError(util.ErrForbidden, util.WithAPIErrorMsg("user not authorized"))
+	}
+
+	delivery, _, err := h.configstoreClient.GetProjectWebhookDelivery(ctx, projectRef, deliveryID)
+	if err != nil {
+		return APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to get webhook delivery"))
+	}
+
+	h.log.Info().Msgf("replaying webhook delivery %s for project %s", deliveryID, projectRef)
+
+	return h.ProcessWebhookDelivery(ctx, delivery, process)
+}
+
+// ProcessWebhookDelivery is the retry/backoff-aware processing step run on
+// each attempt the WebhookDeliveryWorker makes for a persisted delivery, and
+// again on manual replay. process
+// does the actual parsing/run-creation for this delivery's project; it's
+// passed in rather than hardcoded so webhooksHandler can share this
+// bookkeeping without action depending on gitsource parsing.
+func (h *ActionHandler) ProcessWebhookDelivery(ctx context.Context, delivery *cstypes.WebhookDelivery, process func(ctx context.Context, delivery *cstypes.WebhookDelivery) error) error {
+	delivery.LastAttempt = time.Now()
+	err := process(ctx, delivery)
+
+	delivery.Attempts++
+	if err == nil {
+		delivery.State = cstypes.WebhookDeliveryStateDelivered
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= maxWebhookDeliveryAttempts {
+			delivery.State = cstypes.WebhookDeliveryStateDeadLetter
+			h.log.Error().Err(err).Msgf("webhook delivery %s moved to dead-letter queue after %d attempts", delivery.ID, delivery.Attempts)
+		} else {
+			delivery.State = cstypes.WebhookDeliveryStateFailed
+		}
+	}
+
+	if _, _, uerr := h.configstoreClient.UpdateWebhookDelivery(ctx, delivery); uerr != nil {
+		h.log.Err(uerr).Msgf("failed to update webhook delivery %s state", delivery.ID)
+	}
+
+	return err
+}
+
+// WebhookDeliveryWorker polls for pending/failed webhook deliveries whose
+// backoff has elapsed and drives each through processDelivery, so the
+// gateway's webhook endpoint can persist a delivery and return 200
+// immediately instead of blocking the sender on downstream processing.
+//
+// It depends on getPending/processDelivery as plain funcs rather than
+// holding an *ActionHandler directly, so the poll/retry loop itself can be
+// unit-tested (see webhookdelivery_test.go) without needing a real ActionHandler, which
+// requires a wired-up configstore/runservice client to construct.
+type WebhookDeliveryWorker struct {
+	log             zerolog.Logger
+	getPending      func(ctx context.Context) ([]*cstypes.WebhookDelivery, error)
+	processDelivery func(ctx context.Context, delivery *cstypes.WebhookDelivery) error
+	pollInterval    time.Duration
+}
+
+// NewWebhookDeliveryWorker creates a worker that, every pollInterval, fetches
+// deliverable deliveries via getPending and drives each through
+// processDelivery.
+func NewWebhookDeliveryWorker(log zerolog.Logger, getPending func(ctx context.Context) ([]*cstypes.WebhookDelivery, error), processDelivery func(ctx context.Context, delivery *cstypes.WebhookDelivery) error, pollInterval time.Duration) *WebhookDeliveryWorker {
+	return &WebhookDeliveryWorker{log: log, getPending: getPending, processDelivery: processDelivery, pollInterval: pollInterval}
+}
+
+// defaultWebhookDeliveryPollInterval is how often the worker checks
+// configstore for pending/backed-off deliveries when started via
+// StartWebhookDeliveryWorker.
+const defaultWebhookDeliveryPollInterval = 5 * time.Second
+
+// StartWebhookDeliveryWorker builds a WebhookDeliveryWorker bound to h and
+// starts it in its own goroutine. It's the single call gateway setup needs
+// to make, alongside registering webhooksHandler (see
+// api.NewWebhooksHandler), for persisted deliveries to actually be parsed
+// and turned into runs: without it, webhooksHandler.do only ever persists a
+// delivery and nothing ever drains it.
+func (h *ActionHandler) StartWebhookDeliveryWorker(ctx context.Context, process func(ctx context.Context, delivery *cstypes.WebhookDelivery) error) *WebhookDeliveryWorker {
+	getPending := func(ctx context.Context) ([]*cstypes.WebhookDelivery, error) {
+		deliveries, _, err := h.configstoreClient.GetPendingWebhookDeliveries(ctx)
+		if err != nil {
+			return nil, APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to get pending webhook deliveries"))
+		}
+		return deliveries, nil
+	}
+
+	processDelivery := func(ctx context.Context, delivery *cstypes.WebhookDelivery) error {
+		return h.ProcessWebhookDelivery(ctx, delivery, process)
+	}
+
+	w := NewWebhookDeliveryWorker(h.log, getPending, processDelivery, defaultWebhookDeliveryPollInterval)
+	go func() {
+		if err := w.Run(ctx); err != nil && ctx.Err() == nil {
+			h.log.Err(err).Msg("webhook delivery worker stopped unexpectedly")
+		}
+	}()
+	return w
+}
+
+// Run polls until ctx is canceled. It's meant to be started once, in its own
+// goroutine, alongside the gateway's HTTP handlers.
+func (w *WebhookDeliveryWorker) Run(ctx context.Context) error {
+	for {
+		if err := w.runOnce(ctx); err != nil {
+			w.log.Err(err).Msg("failed to poll pending webhook deliveries")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(w.pollInterval):
+		}
+	}
+}
+
+func (w *WebhookDeliveryWorker) runOnce(ctx context.Context) error {
+	deliveries, err := w.getPending(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, delivery := range deliveries {
+		if err := w.processDelivery(ctx, delivery); err != nil {
+			w.log.Err(err).Msgf("failed to process webhook delivery %s", delivery.ID)
+		}
+	}
+
+	return nil
+}
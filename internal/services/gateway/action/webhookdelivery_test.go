@@ -0,0 +1,97 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+// TestWebhookDeliveryWorkerProcessesPendingDeliveries verifies the regression
+// the worker exists to prevent: a delivery that's persisted in the pending
+// state actually gets handed to processDelivery, rather than sitting
+// forever because nothing ever polls for it.
+func TestWebhookDeliveryWorkerProcessesPendingDeliveries(t *testing.T) {
+	pending := &cstypes.WebhookDelivery{ID: "d1", State: cstypes.WebhookDeliveryStatePending}
+
+	var mu sync.Mutex
+	var fetched bool
+	var processed []string
+
+	getPending := func(ctx context.Context) ([]*cstypes.WebhookDelivery, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if fetched {
+			return nil, nil
+		}
+		fetched = true
+		return []*cstypes.WebhookDelivery{pending}, nil
+	}
+
+	processDone := make(chan struct{})
+	processDelivery := func(ctx context.Context, delivery *cstypes.WebhookDelivery) error {
+		mu.Lock()
+		processed = append(processed, delivery.ID)
+		mu.Unlock()
+		close(processDone)
+		return nil
+	}
+
+	w := NewWebhookDeliveryWorker(zerolog.Nop(), getPending, processDelivery, time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = w.Run(ctx) }()
+
+	select {
+	case <-processDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the worker to process the pending delivery")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(processed) != 1 || processed[0] != "d1" {
+		t.Errorf("processed = %v, want [d1]", processed)
+	}
+}
+
+func TestWebhookDeliveryWorkerRunOnceSurfacesGetPendingError(t *testing.T) {
+	wantErr := errTest("boom")
+	getPending := func(ctx context.Context) ([]*cstypes.WebhookDelivery, error) {
+		return nil, wantErr
+	}
+	processDelivery := func(ctx context.Context, delivery *cstypes.WebhookDelivery) error {
+		t.Fatal("processDelivery should not be called when getPending fails")
+		return nil
+	}
+
+	w := NewWebhookDeliveryWorker(zerolog.Nop(), getPending, processDelivery, time.Minute)
+
+	if err := w.runOnce(context.Background()); err != wantErr {
+		t.Errorf("runOnce() error = %v, want %v", err, wantErr)
+	}
+}
+
+type errTest string
+
+func (e errTest) Error() string { return string(e) }
@@ -0,0 +1,124 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/rs/zerolog"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/services/types"
+	"agola.io/agola/internal/util"
+	csclient "agola.io/agola/services/configstore/client"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+// eventsHandler accepts webhooks from arbitrary sources (generic JSON,
+// Docker/container registry image-push, CloudEvents) that can't be parsed by
+// a project's linked git source, and routes them to a project via one of its
+// TriggerRules instead of gitSource.ParseWebhook.
+type eventsHandler struct {
+	log               zerolog.Logger
+	ah                *action.ActionHandler
+	configstoreClient *csclient.Client
+}
+
+func NewEventsHandler(log zerolog.Logger, ah *action.ActionHandler, configstoreClient *csclient.Client) *eventsHandler {
+	return &eventsHandler{
+		log:               log,
+		ah:                ah,
+		configstoreClient: configstoreClient,
+	}
+}
+
+func (h *eventsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := h.do(r)
+	if util.HTTPError(w, err) {
+		h.log.Err(err).Send()
+		return
+	}
+}
+
+func (h *eventsHandler) do(r *http.Request) error {
+	ctx := r.Context()
+
+	projectID := r.URL.Query().Get("projectid")
+	if projectID == "" {
+		return util.NewAPIError(util.ErrBadRequest, util.WithAPIErrorMsgf("bad event url %q. Missing projectid", r.URL))
+	}
+	ruleName := r.URL.Query().Get("rule")
+	if ruleName == "" {
+		return util.NewAPIError(util.ErrBadRequest, util.WithAPIErrorMsgf("bad event url %q. Missing rule", r.URL))
+	}
+
+	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return util.NewAPIErrorWrap(util.ErrBadRequest, err, util.WithAPIErrorMsg("failed to read event body"))
+	}
+
+	csProject, _, err := h.configstoreClient.GetProject(ctx, projectID)
+	if err != nil {
+		return action.APIErrorFromRemoteError(err, util.WithAPIErrorMsgf("failed to get project %s", projectID))
+	}
+	project := csProject.Project
+
+	rules, _, err := h.configstoreClient.GetProjectTriggerRules(ctx, projectID)
+	if err != nil {
+		return action.APIErrorFromRemoteError(err, util.WithAPIErrorMsgf("failed to get trigger rules for project %s", projectID))
+	}
+	var rule *cstypes.TriggerRule
+	for _, tr := range rules {
+		if tr.Name == ruleName {
+			rule = tr
+			break
+		}
+	}
+	if rule == nil {
+		return util.NewAPIError(util.ErrNotExist, util.WithAPIErrorMsgf("no trigger rule %q for project %s", ruleName, projectID))
+	}
+
+	adapter, err := action.GetEventAdapter(rule.AdapterType)
+	if err != nil {
+		return util.NewAPIErrorWrap(util.ErrBadRequest, err, util.WithAPIErrorMsg("unsupported event adapter"))
+	}
+
+	if err := adapter.Verify(r, body, rule); err != nil {
+		return util.NewAPIErrorWrap(util.ErrBadRequest, err, util.WithAPIErrorMsg("event signature verification failed"))
+	}
+
+	parsed, err := adapter.Parse(body, rule)
+	if err != nil {
+		return util.NewAPIErrorWrap(util.ErrBadRequest, err, util.WithAPIErrorMsg("failed to parse event"))
+	}
+
+	req := &action.CreateRunRequest{
+		RunType:            types.RunTypeProject,
+		RefType:            parsed.RefType,
+		RunCreationTrigger: types.RunCreationTriggerTypeEvent,
+
+		Project:      project,
+		CommitSHA:    parsed.CommitSHA,
+		Ref:          parsed.Ref,
+		TemplateVars: parsed.TemplateVars,
+	}
+	if err := h.ah.CreateRuns(ctx, req); err != nil {
+		return util.NewAPIErrorWrap(util.ErrInternal, err, util.WithAPIErrorMsg("failed to create run"))
+	}
+
+	return nil
+}
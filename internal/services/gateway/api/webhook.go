@@ -15,9 +15,13 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"net/http"
 
 	"github.com/rs/zerolog"
+	"github.com/sorintlab/errors"
 
 	"agola.io/agola/internal/services/common"
 	"agola.io/agola/internal/services/gateway/action"
@@ -36,14 +40,23 @@ type webhooksHandler struct {
 	apiExposedURL     string
 }
 
-func NewWebhooksHandler(log zerolog.Logger, ah *action.ActionHandler, configstoreClient *csclient.Client, runserviceClient *rsclient.Client, apiExposedURL string) *webhooksHandler {
-	return &webhooksHandler{
+// NewWebhooksHandler also starts the action.WebhookDeliveryWorker that
+// drains what ServeHTTP/do only persists: without it, webhook deliveries
+// would pile up and never be parsed into runs. ctx bounds the worker's
+// lifetime, so callers should pass the same context the rest of the gateway
+// server shuts down on.
+func NewWebhooksHandler(ctx context.Context, log zerolog.Logger, ah *action.ActionHandler, configstoreClient *csclient.Client, runserviceClient *rsclient.Client, apiExposedURL string) *webhooksHandler {
+	h := &webhooksHandler{
 		log:               log,
 		ah:                ah,
 		configstoreClient: configstoreClient,
 		runserviceClient:  runserviceClient,
 		apiExposedURL:     apiExposedURL,
 	}
+
+	ah.StartWebhookDeliveryWorker(ctx, h.processDelivery)
+
+	return h
 }
 
 func (h *webhooksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -63,6 +76,43 @@ func (h *webhooksHandler) do(r *http.Request) error {
 	}
 
 	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return util.NewAPIErrorWrap(util.ErrBadRequest, err, util.WithAPIErrorMsg("failed to read webhook body"))
+	}
+
+	// Persist the raw delivery and return immediately: the sender always
+	// sees a 200 once the delivery is durably stored, and the actual
+	// parsing/run-creation happens asynchronously on the
+	// action.WebhookDeliveryWorker, which retries with backoff on failure
+	// instead of making the sender wait on (or retry) a downstream error.
+	delivery, _, err := h.configstoreClient.CreateProjectWebhookDelivery(ctx, projectID, &cstypes.WebhookDelivery{
+		ProjectID: projectID,
+		Headers:   r.Header,
+		Body:      body,
+		State:     cstypes.WebhookDeliveryStatePending,
+	})
+	if err != nil {
+		return action.APIErrorFromRemoteError(err, util.WithAPIErrorMsg("failed to persist webhook delivery"))
+	}
+
+	h.log.Info().Msgf("persisted webhook delivery %s for project %s", delivery.ID, projectID)
+
+	return nil
+}
+
+// processDelivery does the actual webhook processing (parsing the project's
+// git source event and creating runs) for a persisted delivery. It's run by
+// the action.WebhookDeliveryWorker on every processing attempt, retries
+// included, and again on every manual replay.
+func (h *webhooksHandler) processDelivery(ctx context.Context, delivery *cstypes.WebhookDelivery) error {
+	projectID := delivery.ProjectID
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, "", io.NopCloser(bytes.NewReader(delivery.Body)))
+	if err != nil {
+		return errors.Wrapf(err, "failed to rebuild webhook request")
+	}
+	r.Header = delivery.Headers
 
 	csProject, _, err := h.configstoreClient.GetProject(ctx, projectID)
 	if err != nil {
@@ -113,6 +163,7 @@ func (h *webhooksHandler) do(r *http.Request) error {
 	if err != nil {
 		return util.NewAPIErrorWrap(util.ErrBadRequest, err, util.WithAPIErrorMsg("failed to parse webhook"))
 	}
+	delivery.SignatureVerified = true
 	// skip nil webhook data
 	// TODO(sgotti) report the reason of the skip
 	if webhookData == nil {
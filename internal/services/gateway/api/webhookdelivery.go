@@ -0,0 +1,115 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+
+	"agola.io/agola/internal/services/gateway/action"
+	"agola.io/agola/internal/util"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+// webhookDeliveriesHandler lists a project's webhook deliveries, optionally
+// filtered by state, so a DLQ view is just this endpoint with
+// state=deadletter.
+type webhookDeliveriesHandler struct {
+	log zerolog.Logger
+	ah  *action.ActionHandler
+}
+
+func NewWebhookDeliveriesHandler(log zerolog.Logger, ah *action.ActionHandler) *webhookDeliveriesHandler {
+	return &webhookDeliveriesHandler{log: log, ah: ah}
+}
+
+func (h *webhookDeliveriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef := vars["projectref"]
+
+	req := &action.GetWebhookDeliveriesRequest{
+		ProjectRef: projectRef,
+		State:      cstypes.WebhookDeliveryState(r.URL.Query().Get("state")),
+	}
+
+	deliveries, err := h.ah.GetWebhookDeliveries(ctx, req)
+	if util.HTTPError(w, err) {
+		h.log.Err(err).Send()
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+		h.log.Err(err).Send()
+	}
+}
+
+// webhookDeliveryHandler returns a single delivery, headers and body
+// included, so a failure can be diagnosed without replaying it blind.
+type webhookDeliveryHandler struct {
+	log zerolog.Logger
+	ah  *action.ActionHandler
+}
+
+func NewWebhookDeliveryHandler(log zerolog.Logger, ah *action.ActionHandler) *webhookDeliveryHandler {
+	return &webhookDeliveryHandler{log: log, ah: ah}
+}
+
+func (h *webhookDeliveryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef := vars["projectref"]
+	deliveryID := vars["deliveryid"]
+
+	delivery, err := h.ah.GetWebhookDelivery(ctx, projectRef, deliveryID)
+	if util.HTTPError(w, err) {
+		h.log.Err(err).Send()
+		return
+	}
+
+	if err := json.NewEncoder(w).Encode(delivery); err != nil {
+		h.log.Err(err).Send()
+	}
+}
+
+// webhookDeliveryReplayHandler reprocesses a delivery that's stuck in the
+// failed or deadletter state.
+type webhookDeliveryReplayHandler struct {
+	log zerolog.Logger
+	ah  *action.ActionHandler
+	wh  *webhooksHandler
+}
+
+func NewWebhookDeliveryReplayHandler(log zerolog.Logger, ah *action.ActionHandler, wh *webhooksHandler) *webhookDeliveryReplayHandler {
+	return &webhookDeliveryReplayHandler{log: log, ah: ah, wh: wh}
+}
+
+func (h *webhookDeliveryReplayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef := vars["projectref"]
+	deliveryID := vars["deliveryid"]
+
+	err := h.ah.ReplayWebhookDelivery(ctx, projectRef, deliveryID, h.wh.processDelivery)
+	if util.HTTPError(w, err) {
+		h.log.Err(err).Send()
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,370 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sorintlab/errors"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+const awsMetadataBaseURL = "http://169.254.169.254/latest"
+
+// secretProviderHTTPTimeout bounds every HTTP call a secret resolver makes
+// (instance/pod metadata, STS, and the provider's own API), so an
+// unreachable or blackholed endpoint (e.g. IMDS off an EC2 instance, or the
+// GCE metadata server off GCP) fails task startup quickly instead of
+// hanging on the OS-level TCP timeout.
+const secretProviderHTTPTimeout = 10 * time.Second
+
+// awsCredentials are the short-lived (or long-lived, for the static env var
+// case) credentials used to sign a request to an AWS service.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// awsSMSecretResolver fetches secret data from AWS Secrets Manager,
+// authenticating with the EC2 instance profile unless config.RoleARN is set,
+// in which case that role is assumed first via STS. ECS/Fargate task roles
+// (fetched over AWS_CONTAINER_CREDENTIALS_RELATIVE_URI instead of IMDS) are
+// not supported.
+type awsSMSecretResolver struct {
+	config            *cstypes.AWSSMConfig
+	hc                *http.Client
+	metadataURL       string
+	stsURL            string
+	secretsManagerURL string
+}
+
+func newAWSSMSecretResolver(config *cstypes.AWSSMConfig) (*awsSMSecretResolver, error) {
+	if config == nil {
+		return nil, errors.Errorf("missing awssm config")
+	}
+	if config.Region == "" {
+		return nil, errors.Errorf("missing awssm region")
+	}
+
+	return &awsSMSecretResolver{
+		config:            config,
+		hc:                &http.Client{Timeout: secretProviderHTTPTimeout},
+		metadataURL:       awsMetadataBaseURL,
+		stsURL:            fmt.Sprintf("https://sts.%s.amazonaws.com/", config.Region),
+		secretsManagerURL: fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", config.Region),
+	}, nil
+}
+
+// GetSecretData calls GetSecretValue on AWS Secrets Manager for the secret
+// identified by id (a secret name or ARN), and unmarshals its SecretString
+// as a JSON object, the shape the AWS console itself writes for a
+// key/value secret.
+func (r *awsSMSecretResolver) GetSecretData(ctx context.Context, id string) (map[string]string, error) {
+	creds, err := r.credentials(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to resolve aws credentials")
+	}
+
+	reqBody, err := json.Marshal(map[string]string{"SecretId": id})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal request")
+	}
+
+	var out struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := r.signedRequest(ctx, creds, r.secretsManagerURL, "secretsmanager", "secretsmanager.GetSecretValue", reqBody, &out); err != nil {
+		return nil, errors.Wrapf(err, "failed to get secret value from secrets manager")
+	}
+
+	var data map[string]string
+	if err := json.Unmarshal([]byte(out.SecretString), &data); err != nil {
+		return nil, errors.Wrapf(err, "secret %q is not a json object of string values", id)
+	}
+
+	return data, nil
+}
+
+// credentials resolves the AWS credentials used to sign requests: static
+// credentials from the environment if set (the convention every AWS SDK
+// follows), otherwise the EC2 instance profile credentials, further
+// exchanged for config.RoleARN's credentials via STS AssumeRole when set.
+func (r *awsSMSecretResolver) credentials(ctx context.Context) (awsCredentials, error) {
+	if ak := os.Getenv("AWS_ACCESS_KEY_ID"); ak != "" {
+		return awsCredentials{
+			AccessKeyID:     ak,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	creds, err := r.instanceProfileCredentials(ctx)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	if r.config.RoleARN == "" {
+		return creds, nil
+	}
+
+	return r.assumeRole(ctx, creds)
+}
+
+// instanceProfileCredentials fetches the temporary credentials for the role
+// attached to the running EC2 instance, via the (v2, token-protected)
+// instance metadata service.
+func (r *awsSMSecretResolver) instanceProfileCredentials(ctx context.Context) (awsCredentials, error) {
+	tokenReq, err := http.NewRequestWithContext(ctx, http.MethodPut, r.metadataURL+"/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, errors.Wrapf(err, "failed to create imds token request")
+	}
+	tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	tokenResp, err := r.hc.Do(tokenReq)
+	if err != nil {
+		return awsCredentials{}, errors.Wrapf(err, "failed to fetch imds token")
+	}
+	defer tokenResp.Body.Close()
+	if tokenResp.StatusCode >= 300 {
+		return awsCredentials{}, errors.Errorf("imds token request failed with status %d", tokenResp.StatusCode)
+	}
+	token, err := readAll(tokenResp.Body)
+	if err != nil {
+		return awsCredentials{}, errors.Wrapf(err, "failed to read imds token")
+	}
+
+	roleURL := r.metadataURL + "/meta-data/iam/security-credentials/"
+	role, err := r.metadataGet(ctx, roleURL, token)
+	if err != nil {
+		return awsCredentials{}, errors.Wrapf(err, "failed to fetch instance profile role name")
+	}
+
+	var creds struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		Token           string `json:"Token"`
+	}
+	credsBody, err := r.metadataGet(ctx, roleURL+strings.TrimSpace(role), token)
+	if err != nil {
+		return awsCredentials{}, errors.Wrapf(err, "failed to fetch instance profile credentials")
+	}
+	if err := json.Unmarshal([]byte(credsBody), &creds); err != nil {
+		return awsCredentials{}, errors.Wrapf(err, "failed to unmarshal instance profile credentials")
+	}
+
+	return awsCredentials{AccessKeyID: creds.AccessKeyID, SecretAccessKey: creds.SecretAccessKey, SessionToken: creds.Token}, nil
+}
+
+func (r *awsSMSecretResolver) metadataGet(ctx context.Context, url, token string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", token)
+
+	resp, err := r.hc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", errors.Errorf("metadata request to %q failed with status %d", url, resp.StatusCode)
+	}
+
+	return readAll(resp.Body)
+}
+
+// assumeRole exchanges base credentials for config.RoleARN's credentials via
+// STS AssumeRole, the only way to reach a role in another account or with a
+// narrower policy than the instance profile's.
+func (r *awsSMSecretResolver) assumeRole(ctx context.Context, base awsCredentials) (awsCredentials, error) {
+	form := url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {"2011-06-15"},
+		"RoleArn":         {r.config.RoleARN},
+		"RoleSessionName": {"agola-executor"},
+	}
+
+	var out struct {
+		AssumeRoleResult struct {
+			Credentials struct {
+				AccessKeyID     string `xml:"AccessKeyId"`
+				SecretAccessKey string `xml:"SecretAccessKey"`
+				SessionToken    string `xml:"SessionToken"`
+			} `xml:"Credentials"`
+		} `xml:"AssumeRoleResult"`
+	}
+	if err := r.signedFormRequest(ctx, base, r.stsURL, "sts", form, &out); err != nil {
+		return awsCredentials{}, errors.Wrapf(err, "failed to assume role %q", r.config.RoleARN)
+	}
+
+	return awsCredentials{
+		AccessKeyID:     out.AssumeRoleResult.Credentials.AccessKeyID,
+		SecretAccessKey: out.AssumeRoleResult.Credentials.SecretAccessKey,
+		SessionToken:    out.AssumeRoleResult.Credentials.SessionToken,
+	}, nil
+}
+
+// signedRequest issues a SigV4-signed JSON-protocol POST (used by Secrets
+// Manager) and JSON-decodes the response body into out.
+func (r *awsSMSecretResolver) signedRequest(ctx context.Context, creds awsCredentials, endpoint, service, target string, body []byte, out interface{}) error {
+	return r.doSigned(ctx, creds, endpoint, service, body, out, jsonDecode, func(req *http.Request) {
+		req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+		req.Header.Set("X-Amz-Target", target)
+	})
+}
+
+// signedFormRequest issues a SigV4-signed Query-protocol POST (used by STS)
+// and XML-decodes the response body into out.
+func (r *awsSMSecretResolver) signedFormRequest(ctx context.Context, creds awsCredentials, endpoint, service string, form url.Values, out interface{}) error {
+	body := []byte(form.Encode())
+	return r.doSigned(ctx, creds, endpoint, service, body, out, xmlDecode, func(req *http.Request) {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	})
+}
+
+// doSigned builds a SigV4-signed POST to endpoint, applies setHeaders (the
+// one thing signedRequest/signedFormRequest differ on besides decoding),
+// and runs it, decoding a non-error response body into out with decode.
+func (r *awsSMSecretResolver) doSigned(ctx context.Context, creds awsCredentials, endpoint, service string, body []byte, out interface{}, decode func(io.Reader, interface{}) error, setHeaders func(*http.Request)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrapf(err, "failed to create request")
+	}
+	setHeaders(req)
+
+	if err := signAWSRequestV4(req, body, creds, r.config.Region, service); err != nil {
+		return errors.Wrapf(err, "failed to sign request")
+	}
+
+	resp, err := r.hc.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		respBody, _ := readAll(resp.Body)
+		return errors.Errorf("request to %q failed with status %d: %s", endpoint, resp.StatusCode, respBody)
+	}
+
+	if out != nil {
+		if err := decode(resp.Body, out); err != nil {
+			return errors.Wrapf(err, "failed to decode response")
+		}
+	}
+
+	return nil
+}
+
+// signAWSRequestV4 signs req in place with AWS Signature Version 4
+// (https://docs.aws.amazon.com/general/latest/gr/sigv4-create-signed-request.html),
+// the scheme every AWS service requires.
+func signAWSRequestV4(req *http.Request, body []byte, creds awsCredentials, region, service string) error {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("Host", req.URL.Host)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	signedHeaders := []string{"content-type", "host", "x-amz-date"}
+	if creds.SessionToken != "" {
+		signedHeaders = append(signedHeaders, "x-amz-security-token")
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, h := range signedHeaders {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", h, strings.TrimSpace(req.Header.Get(http.CanonicalHeaderKey(h))))
+	}
+
+	canonicalRequest := req.Method + "\n" +
+		reqPathOrSlash(req) + "\n" +
+		"\n" +
+		canonicalHeaders.String() + "\n" +
+		strings.Join(signedHeaders, ";") + "\n" +
+		payloadHash
+
+	credentialScope := fmt.Sprintf("%s/%s/%s/aws4_request", dateStamp, region, service)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		credentialScope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := awsSigningKey(creds.SecretAccessKey, dateStamp, region, service)
+	signature := hex.EncodeToString(hmacSHA256(signingKey, []byte(stringToSign)))
+
+	authHeader := fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, credentialScope, strings.Join(signedHeaders, ";"), signature)
+	req.Header.Set("Authorization", authHeader)
+
+	return nil
+}
+
+func reqPathOrSlash(req *http.Request) string {
+	if req.URL.EscapedPath() == "" {
+		return "/"
+	}
+	return req.URL.EscapedPath()
+}
+
+func awsSigningKey(secretKey, dateStamp, region, service string) []byte {
+	kDate := hmacSHA256([]byte("AWS4"+secretKey), []byte(dateStamp))
+	kRegion := hmacSHA256(kDate, []byte(region))
+	kService := hmacSHA256(kRegion, []byte(service))
+	return hmacSHA256(kService, []byte("aws4_request"))
+}
+
+func hmacSHA256(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func readAll(r io.Reader) (string, error) {
+	b, err := io.ReadAll(r)
+	return string(b), err
+}
+
+func xmlDecode(r io.Reader, out interface{}) error {
+	return xml.NewDecoder(r).Decode(out)
+}
+
+func jsonDecode(r io.Reader, out interface{}) error {
+	return json.NewDecoder(r).Decode(out)
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+func TestAWSSMSecretResolverGetSecretData(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=test-key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var req struct {
+			SecretId string `json:"SecretId"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.SecretId != "myapp/db" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"SecretString": `{"password":"hunter2"}`,
+		})
+	}))
+	defer srv.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret")
+
+	resolver, err := newAWSSMSecretResolver(&cstypes.AWSSMConfig{Region: "us-east-1"})
+	if err != nil {
+		t.Fatalf("newAWSSMSecretResolver() error = %v", err)
+	}
+	resolver.hc = srv.Client()
+	resolver.secretsManagerURL = srv.URL
+
+	data, err := resolver.GetSecretData(context.Background(), "myapp/db")
+	if err != nil {
+		t.Fatalf("GetSecretData() error = %v", err)
+	}
+	if data["password"] != "hunter2" {
+		t.Fatalf("GetSecretData() = %v, want password=hunter2", data)
+	}
+}
+
+func TestAWSSMSecretResolverGetSecretDataForbidden(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test-key")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test-secret")
+
+	resolver, err := newAWSSMSecretResolver(&cstypes.AWSSMConfig{Region: "us-east-1"})
+	if err != nil {
+		t.Fatalf("newAWSSMSecretResolver() error = %v", err)
+	}
+	resolver.hc = srv.Client()
+	resolver.secretsManagerURL = srv.URL
+
+	if _, err := resolver.GetSecretData(context.Background(), "myapp/db"); err == nil {
+		t.Fatal("GetSecretData() expected error, got nil")
+	}
+}
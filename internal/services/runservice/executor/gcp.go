@@ -0,0 +1,144 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sorintlab/errors"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+const (
+	gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	gcpSecretManagerURL = "https://secretmanager.googleapis.com/v1"
+)
+
+// gcpSMSecretResolver fetches secret data from GCP Secret Manager, using the
+// ambient application default credentials (the GCE/GKE metadata server)
+// unless config.WorkloadIdentityProvider is set, in which case there's no
+// metadata server to fall back to and federating an external token through
+// GCP's STS isn't implemented.
+type gcpSMSecretResolver struct {
+	config           *cstypes.GCPSMConfig
+	hc               *http.Client
+	metadataTokenURL string
+	secretManagerURL string
+}
+
+func newGCPSMSecretResolver(config *cstypes.GCPSMConfig) (*gcpSMSecretResolver, error) {
+	if config == nil {
+		return nil, errors.Errorf("missing gcpsm config")
+	}
+	if config.ProjectID == "" {
+		return nil, errors.Errorf("missing gcpsm project id")
+	}
+	if config.WorkloadIdentityProvider != "" {
+		return nil, errors.Errorf("gcp secret manager workload identity federation (workload_identity_provider) is not implemented, only ambient application default credentials are supported")
+	}
+
+	return &gcpSMSecretResolver{
+		config:           config,
+		hc:               &http.Client{Timeout: secretProviderHTTPTimeout},
+		metadataTokenURL: gcpMetadataTokenURL,
+		secretManagerURL: gcpSecretManagerURL,
+	}, nil
+}
+
+// GetSecretData accesses the latest version of the named secret on GCP
+// Secret Manager. The payload is expected to be a JSON object of string
+// values, the same convention used for every other secret provider; a
+// payload that isn't valid JSON is returned as a single "value" entry
+// instead of erroring, since a lot of real-world GCP secrets just hold a
+// single opaque blob rather than a key/value set.
+func (r *gcpSMSecretResolver) GetSecretData(ctx context.Context, name string) (map[string]string, error) {
+	token, err := r.accessToken(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get application default credentials token")
+	}
+
+	url := fmt.Sprintf("%s/projects/%s/secrets/%s/versions/latest:access", r.secretManagerURL, r.config.ProjectID, name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create secret manager request")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := r.hc.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "secret manager request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, errors.Errorf("secret manager request to %q failed with status %d", url, resp.StatusCode)
+	}
+
+	var accessResp struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&accessResp); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode secret manager response")
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(accessResp.Payload.Data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode secret payload")
+	}
+
+	var data map[string]string
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return map[string]string{"value": string(payload)}, nil
+	}
+
+	return data, nil
+}
+
+// accessToken fetches an OAuth2 access token for the instance/pod's
+// attached service account from the GCE/GKE metadata server.
+func (r *gcpSMSecretResolver) accessToken(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.metadataTokenURL, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create metadata request")
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := r.hc.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "metadata request failed")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", errors.Errorf("metadata request to %q failed with status %d", r.metadataTokenURL, resp.StatusCode)
+	}
+
+	var tokenResp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", errors.Wrapf(err, "failed to decode metadata token response")
+	}
+	if tokenResp.AccessToken == "" {
+		return "", errors.Errorf("metadata server returned no access token")
+	}
+
+	return tokenResp.AccessToken, nil
+}
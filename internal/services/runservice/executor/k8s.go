@@ -0,0 +1,126 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/sorintlab/errors"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+const (
+	defaultK8sServiceAccountCACertPath = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// k8sSecretResolver reads a Secret object out of the Kubernetes cluster the
+// executor pod is running in, authenticating with the pod's own service
+// account token.
+type k8sSecretResolver struct {
+	config    *cstypes.K8sConfig
+	hc        *http.Client
+	apiServer string
+	tokenPath string
+}
+
+func newK8sSecretResolver(config *cstypes.K8sConfig) (*k8sSecretResolver, error) {
+	if config == nil {
+		return nil, errors.Errorf("missing k8s config")
+	}
+	if config.Namespace == "" {
+		return nil, errors.Errorf("missing k8s namespace")
+	}
+
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.Errorf("executor is not running in a kubernetes pod (KUBERNETES_SERVICE_HOST/PORT unset)")
+	}
+
+	caCert, err := os.ReadFile(defaultK8sServiceAccountCACertPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read kubernetes service account ca cert")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, errors.Errorf("failed to parse kubernetes service account ca cert")
+	}
+
+	hc := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		Timeout:   secretProviderHTTPTimeout,
+	}
+
+	return &k8sSecretResolver{
+		config:    config,
+		hc:        hc,
+		apiServer: fmt.Sprintf("https://%s", net.JoinHostPort(host, port)),
+		tokenPath: defaultKubernetesServiceAccountTokenPath,
+	}, nil
+}
+
+// GetSecretData reads the named Secret object from config.Namespace and
+// base64-decodes its .data values back into plaintext, the same way kubectl
+// does, using the pod's own in-cluster service account to authenticate.
+func (r *k8sSecretResolver) GetSecretData(ctx context.Context, name string) (map[string]string, error) {
+	token, err := os.ReadFile(r.tokenPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read kubernetes service account token")
+	}
+
+	url := fmt.Sprintf("%s/api/v1/namespaces/%s/secrets/%s", r.apiServer, r.config.Namespace, name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create kubernetes api request")
+	}
+	req.Header.Set("Authorization", "Bearer "+string(token))
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := r.hc.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "kubernetes api request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, errors.Errorf("kubernetes api request to %q failed with status %d", url, resp.StatusCode)
+	}
+
+	var secret struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode kubernetes secret response")
+	}
+
+	data := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		decoded, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode secret key %q", k)
+		}
+		data[k] = string(decoded)
+	}
+
+	return data, nil
+}
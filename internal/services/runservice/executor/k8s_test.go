@@ -0,0 +1,84 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+func TestK8sSecretResolverGetSecretData(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/namespaces/default/secrets/db" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"password":"aHVudGVyMg=="}}`))
+	}))
+	defer srv.Close()
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("test-token"), 0o600); err != nil {
+		t.Fatalf("failed to write test token: %v", err)
+	}
+
+	resolver := &k8sSecretResolver{
+		config:    &cstypes.K8sConfig{Namespace: "default"},
+		hc:        srv.Client(),
+		apiServer: srv.URL,
+		tokenPath: tokenPath,
+	}
+
+	data, err := resolver.GetSecretData(context.Background(), "db")
+	if err != nil {
+		t.Fatalf("GetSecretData() error = %v", err)
+	}
+	if data["password"] != "hunter2" {
+		t.Fatalf("GetSecretData() = %v, want password=hunter2", data)
+	}
+}
+
+func TestK8sSecretResolverGetSecretDataForbidden(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	tokenPath := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenPath, []byte("bad-token"), 0o600); err != nil {
+		t.Fatalf("failed to write test token: %v", err)
+	}
+
+	resolver := &k8sSecretResolver{
+		config:    &cstypes.K8sConfig{Namespace: "default"},
+		hc:        srv.Client(),
+		apiServer: srv.URL,
+		tokenPath: tokenPath,
+	}
+
+	if _, err := resolver.GetSecretData(context.Background(), "db"); err == nil {
+		t.Fatal("GetSecretData() expected error, got nil")
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+
+	"github.com/sorintlab/errors"
+
+	"agola.io/agola/internal/services/configstore/kms"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+// decryptSecretData is the only place a secret's envelope-encrypted Data is
+// ever turned back into plaintext: right before it's injected as env/file
+// into a starting task. kmsProvider unwraps the DEK, which is then used
+// locally and discarded; the gateway and configstore never decrypt
+// enc.Ciphertext (they only handle a secret's plaintext on its way to
+// being encrypted).
+func decryptSecretData(ctx context.Context, kmsProvider kms.KMSProvider, enc *cstypes.EncryptedSecretData) (map[string]string, error) {
+	if enc.Alg != cstypes.EncryptionAlgAES256GCM {
+		return nil, errors.Errorf("unsupported encryption alg %q", enc.Alg)
+	}
+
+	dek, err := kmsProvider.UnwrapDEK(ctx, enc.WrappedDEK, enc.KEKID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to unwrap dek")
+	}
+	defer func() {
+		for i := range dek {
+			dek[i] = 0
+		}
+	}()
+
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to init aes cipher")
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to init gcm")
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(enc.Ciphertext) < nonceSize {
+		return nil, errors.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := enc.Ciphertext[:nonceSize], enc.Ciphertext[nonceSize:]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decrypt secret data")
+	}
+
+	var data map[string]string
+	if err := json.Unmarshal(plaintext, &data); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal decrypted secret data")
+	}
+
+	return data, nil
+}
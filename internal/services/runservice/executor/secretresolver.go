@@ -0,0 +1,72 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+
+	"github.com/sorintlab/errors"
+
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+// secretProviderResolver fetches the value at path from an external secret
+// provider. It's called once per referenced external secret at task startup,
+// right before the value is injected into the task's env/file, so that
+// plaintext only ever exists in the executor process and the running task.
+type secretProviderResolver interface {
+	GetSecretData(ctx context.Context, path string) (map[string]string, error)
+}
+
+// getSecretProviderResolver builds the resolver for sp, authenticating with
+// whatever method sp.Type requires.
+func getSecretProviderResolver(ctx context.Context, sp *csapitypes.SecretProvider) (secretProviderResolver, error) {
+	switch sp.Type {
+	case cstypes.SecretProviderTypeVault:
+		return newVaultSecretResolver(sp.Vault)
+	case cstypes.SecretProviderTypeAWSSM:
+		return newAWSSMSecretResolver(sp.AWSSM)
+	case cstypes.SecretProviderTypeGCPSM:
+		return newGCPSMSecretResolver(sp.GCPSM)
+	case cstypes.SecretProviderTypeK8s:
+		return newK8sSecretResolver(sp.K8s)
+	default:
+		return nil, errors.Errorf("unknown secret provider type %q", sp.Type)
+	}
+}
+
+// resolveExternalSecret fetches and returns the data for an external secret
+// referenced by secretProviderID/path, for injection into a running task.
+func (e *Executor) resolveExternalSecret(ctx context.Context, secretProviderID, path string) (map[string]string, error) {
+	sp, _, err := e.configstoreClient.GetSecretProvider(ctx, secretProviderID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get secret provider %q", secretProviderID)
+	}
+
+	resolver, err := getSecretProviderResolver(ctx, sp)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to setup secret provider %q", secretProviderID)
+	}
+
+	data, err := resolver.GetSecretData(ctx, path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch secret data from provider %q at path %q", secretProviderID, path)
+	}
+
+	e.log.Info().Msgf("fetched external secret from provider %q (%s) at path %q", sp.Name, sp.Type, path)
+
+	return data, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+
+	"github.com/sorintlab/errors"
+
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+// resolveTaskSecrets resolves the plaintext data for every secret a task
+// references. It's called once, at task startup, right before secrets are
+// injected into the task's env/file: external secrets are fetched from
+// their configured provider, envelope-encrypted secrets are decrypted, and
+// any other secret's data is used as received from configstore. The
+// returned map is keyed by secret name.
+func (e *Executor) resolveTaskSecrets(ctx context.Context, secrets []*csapitypes.Secret) (map[string]map[string]string, error) {
+	resolved := make(map[string]map[string]string, len(secrets))
+
+	for _, s := range secrets {
+		switch {
+		case s.Type == cstypes.SecretTypeExternal:
+			data, err := e.resolveExternalSecret(ctx, s.SecretProviderID, s.Path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to resolve external secret %q", s.Name)
+			}
+			resolved[s.Name] = data
+		case s.Encrypted != nil:
+			data, err := decryptSecretData(ctx, e.kmsProvider, s.Encrypted)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to decrypt secret %q", s.Name)
+			}
+			resolved[s.Name] = data
+		default:
+			resolved[s.Name] = s.Secret
+		}
+	}
+
+	return resolved, nil
+}
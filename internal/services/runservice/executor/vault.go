@@ -0,0 +1,159 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sorintlab/errors"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+const defaultKubernetesServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// vaultSecretResolver fetches secret data from a HashiCorp Vault KV v2
+// engine, authenticating with the AppRole or Kubernetes auth method
+// configured on the secret provider.
+type vaultSecretResolver struct {
+	config *cstypes.VaultConfig
+	hc     *http.Client
+}
+
+func newVaultSecretResolver(config *cstypes.VaultConfig) (*vaultSecretResolver, error) {
+	if config == nil {
+		return nil, errors.Errorf("missing vault config")
+	}
+	if config.Addr == "" {
+		return nil, errors.Errorf("missing vault addr")
+	}
+	if config.MountPath == "" {
+		return nil, errors.Errorf("missing vault mount path")
+	}
+
+	return &vaultSecretResolver{config: config, hc: &http.Client{Timeout: secretProviderHTTPTimeout}}, nil
+}
+
+// GetSecretData logs into Vault using the configured auth method and reads
+// the KV v2 secret at path, returning its latest version's data.
+func (r *vaultSecretResolver) GetSecretData(ctx context.Context, path string) (map[string]string, error) {
+	token, err := r.login(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to login to vault")
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimSuffix(r.config.Addr, "/"), r.config.MountPath, strings.TrimPrefix(path, "/"))
+	var kvResp struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := r.do(ctx, http.MethodGet, url, token, nil, &kvResp); err != nil {
+		return nil, errors.Wrapf(err, "failed to read vault secret at %q", path)
+	}
+
+	return kvResp.Data.Data, nil
+}
+
+// login authenticates to Vault using AppRole or Kubernetes auth and returns
+// a client token, which is discarded by the caller as soon as the secret
+// read completes.
+func (r *vaultSecretResolver) login(ctx context.Context) (string, error) {
+	var loginPath string
+	var loginReq map[string]string
+
+	switch r.config.AuthType {
+	case cstypes.VaultAuthTypeAppRole:
+		if r.config.RoleID == "" || r.config.SecretID == "" {
+			return "", errors.Errorf("approle auth requires role_id and secret_id")
+		}
+		loginPath = "/v1/auth/approle/login"
+		loginReq = map[string]string{"role_id": r.config.RoleID, "secret_id": r.config.SecretID}
+	case cstypes.VaultAuthTypeKubernetes:
+		authPath := r.config.KubernetesAuthPath
+		if authPath == "" {
+			authPath = "kubernetes"
+		}
+		jwt, err := os.ReadFile(defaultKubernetesServiceAccountTokenPath)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to read kubernetes service account token")
+		}
+		loginPath = fmt.Sprintf("/v1/auth/%s/login", authPath)
+		loginReq = map[string]string{"role": r.config.KubernetesRole, "jwt": string(jwt)}
+	default:
+		return "", errors.Errorf("unsupported vault auth type %q", r.config.AuthType)
+	}
+
+	url := strings.TrimSuffix(r.config.Addr, "/") + loginPath
+	var loginResp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := r.do(ctx, http.MethodPost, url, "", loginReq, &loginResp); err != nil {
+		return "", err
+	}
+	if loginResp.Auth.ClientToken == "" {
+		return "", errors.Errorf("vault login response has no client token")
+	}
+
+	return loginResp.Auth.ClientToken, nil
+}
+
+func (r *vaultSecretResolver) do(ctx context.Context, method, url, token string, body, out interface{}) error {
+	var bodyReader *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrapf(err, "failed to marshal vault request")
+		}
+		bodyReader = bytes.NewReader(b)
+	} else {
+		bodyReader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create vault request")
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.hc.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "vault request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("vault request to %q failed with status %d", url, resp.StatusCode)
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return errors.Wrapf(err, "failed to decode vault response")
+		}
+	}
+
+	return nil
+}
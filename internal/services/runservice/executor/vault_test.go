@@ -0,0 +1,96 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+func TestVaultSecretResolverGetSecretData(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			var req map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req["role_id"] != "test-role" || req["secret_id"] != "test-secret" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"auth": map[string]string{"client_token": "test-token"},
+			})
+		case "/v1/secret/data/myapp/db":
+			if r.Header.Get("X-Vault-Token") != "test-token" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"data": map[string]string{"password": "hunter2"},
+				},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	resolver, err := newVaultSecretResolver(&cstypes.VaultConfig{
+		Addr:      srv.URL,
+		AuthType:  cstypes.VaultAuthTypeAppRole,
+		MountPath: "secret",
+		RoleID:    "test-role",
+		SecretID:  "test-secret",
+	})
+	if err != nil {
+		t.Fatalf("newVaultSecretResolver() error = %v", err)
+	}
+
+	data, err := resolver.GetSecretData(context.Background(), "myapp/db")
+	if err != nil {
+		t.Fatalf("GetSecretData() error = %v", err)
+	}
+	if data["password"] != "hunter2" {
+		t.Fatalf("GetSecretData() = %v, want password=hunter2", data)
+	}
+}
+
+func TestVaultSecretResolverGetSecretDataBadCreds(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	resolver, err := newVaultSecretResolver(&cstypes.VaultConfig{
+		Addr:      srv.URL,
+		AuthType:  cstypes.VaultAuthTypeAppRole,
+		MountPath: "secret",
+		RoleID:    "bad",
+		SecretID:  "bad",
+	})
+	if err != nil {
+		t.Fatalf("newVaultSecretResolver() error = %v", err)
+	}
+
+	if _, err := resolver.GetSecretData(context.Background(), "myapp/db"); err == nil {
+		t.Fatalf("GetSecretData() expected error, got nil")
+	}
+}
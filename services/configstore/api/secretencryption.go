@@ -0,0 +1,82 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog"
+
+	"agola.io/agola/internal/services/configstore/command"
+	csapitypes "agola.io/agola/services/configstore/api/types"
+)
+
+// SecretEncryptionHandler envelope-encrypts the plaintext data of a secret,
+// so the caller (the secret create/update flow) can attach the resulting
+// ciphertext to the create/update request instead of sending it plaintext.
+type SecretEncryptionHandler struct {
+	log zerolog.Logger
+	ch  *command.CommandHandler
+}
+
+func NewSecretEncryptionHandler(log zerolog.Logger, ch *command.CommandHandler) *SecretEncryptionHandler {
+	return &SecretEncryptionHandler{log: log, ch: ch}
+}
+
+func (h *SecretEncryptionHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req csapitypes.EncryptSecretDataRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	enc, err := h.ch.EncryptSecretData(r.Context(), req.Key, req.OldKey, req.Data)
+	if writeError(w, err) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, enc)
+}
+
+// RotateKEKHandler re-wraps every known secret's DEK under the KMS provider
+// previously staged on the CommandHandler, making it the current one.
+type RotateKEKHandler struct {
+	log zerolog.Logger
+	ch  *command.CommandHandler
+}
+
+func NewRotateKEKHandler(log zerolog.Logger, ch *command.CommandHandler) *RotateKEKHandler {
+	return &RotateKEKHandler{log: log, ch: ch}
+}
+
+func (h *RotateKEKHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rotated, err := h.ch.RotateKEK(r.Context())
+	if writeError(w, err) {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"rotated": rotated})
+}
@@ -0,0 +1,108 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package api implements the configstore HTTP API for the resources added
+// alongside external secret providers, generic event trigger rules and the
+// webhook delivery inbox: SecretProvider, TriggerRule and WebhookDelivery.
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+
+	"agola.io/agola/internal/services/configstore/command"
+	csapitypes "agola.io/agola/services/configstore/api/types"
+)
+
+type SecretProvidersHandler struct {
+	log zerolog.Logger
+	ch  *command.CommandHandler
+}
+
+func NewSecretProvidersHandler(log zerolog.Logger, ch *command.CommandHandler) *SecretProvidersHandler {
+	return &SecretProvidersHandler{log: log, ch: ch}
+}
+
+func (h *SecretProvidersHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet:
+		sps, err := h.ch.GetSecretProviders(ctx)
+		if writeError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, sps)
+	case http.MethodPost:
+		var req csapitypes.CreateUpdateSecretProviderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, err)
+			return
+		}
+		sp, err := h.ch.CreateSecretProvider(ctx, &req)
+		if writeError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusCreated, sp)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type SecretProviderHandler struct {
+	log zerolog.Logger
+	ch  *command.CommandHandler
+}
+
+func NewSecretProviderHandler(log zerolog.Logger, ch *command.CommandHandler) *SecretProviderHandler {
+	return &SecretProviderHandler{log: log, ch: ch}
+}
+
+func (h *SecretProviderHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := mux.Vars(r)["name"]
+
+	switch r.Method {
+	case http.MethodGet:
+		// Unlike Update/Delete below, Get is keyed by the provider's generated
+		// ID rather than its Name: it backs the executor's runtime secret
+		// resolution, which only ever has the ID a secret was created with.
+		sp, err := h.ch.GetSecretProvider(ctx, name)
+		if writeError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, sp)
+	case http.MethodPut:
+		var req csapitypes.CreateUpdateSecretProviderRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, err)
+			return
+		}
+		sp, err := h.ch.UpdateSecretProvider(ctx, name, &req)
+		if writeError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, sp)
+	case http.MethodDelete:
+		if err := h.ch.DeleteSecretProvider(ctx, name); writeError(w, err) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
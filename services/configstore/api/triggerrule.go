@@ -0,0 +1,88 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+
+	"agola.io/agola/internal/services/configstore/command"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+type ProjectTriggerRulesHandler struct {
+	log zerolog.Logger
+	ch  *command.CommandHandler
+}
+
+func NewProjectTriggerRulesHandler(log zerolog.Logger, ch *command.CommandHandler) *ProjectTriggerRulesHandler {
+	return &ProjectTriggerRulesHandler{log: log, ch: ch}
+}
+
+func (h *ProjectTriggerRulesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectRef := mux.Vars(r)["projectref"]
+
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := h.ch.GetProjectTriggerRules(ctx, projectRef)
+		if writeError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, rules)
+	case http.MethodPost:
+		var rule cstypes.TriggerRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			writeError(w, err)
+			return
+		}
+		created, err := h.ch.CreateProjectTriggerRule(ctx, projectRef, &rule)
+		if writeError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type ProjectTriggerRuleHandler struct {
+	log zerolog.Logger
+	ch  *command.CommandHandler
+}
+
+func NewProjectTriggerRuleHandler(log zerolog.Logger, ch *command.CommandHandler) *ProjectTriggerRuleHandler {
+	return &ProjectTriggerRuleHandler{log: log, ch: ch}
+}
+
+func (h *ProjectTriggerRuleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef := vars["projectref"]
+	name := vars["triggerrulename"]
+
+	switch r.Method {
+	case http.MethodDelete:
+		if err := h.ch.DeleteProjectTriggerRule(ctx, projectRef, name); writeError(w, err) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+type Secret struct {
+	ID string `json:"id"`
+
+	Name   string             `json:"name"`
+	Type   cstypes.SecretType `json:"type"`
+	Secret map[string]string  `json:"secret"`
+
+	// external secret
+	SecretProviderID string `json:"secret_provider_id,omitempty"`
+	Path             string `json:"path,omitempty"`
+
+	// Encrypted is set for internal secrets once their Data has been
+	// envelope-encrypted; when set, Secret no longer holds the plaintext and
+	// consumers (e.g. the runservice executor) must decrypt it instead.
+	Encrypted *cstypes.EncryptedSecretData `json:"encrypted,omitempty"`
+
+	ParentPath string `json:"parent_path"`
+}
+
+type CreateUpdateSecretRequest struct {
+	Name string             `json:"name"`
+	Type cstypes.SecretType `json:"type"`
+
+	// internal secret: Data carries the plaintext when the caller wants
+	// configstore to encrypt it server-side; Encrypted carries an
+	// already-encrypted blob when the caller (the gateway action, as of the
+	// secret envelope encryption request) encrypted it up front instead.
+	// Exactly one of the two is set for an internal secret.
+	Data      map[string]string            `json:"data"`
+	Encrypted *cstypes.EncryptedSecretData `json:"encrypted,omitempty"`
+
+	// external secret
+	SecretProviderID string `json:"secret_provider_id,omitempty"`
+	Path             string `json:"path,omitempty"`
+}
+
+// EncryptSecretDataRequest is the wire format for the
+// POST /api/v1alpha/secrets/encrypt request body, shared between the client
+// and the server handler so they can't drift apart. Key identifies the
+// secret for later RotateKEK purposes (see action.secretEncryptionKey); it
+// can contain "/" so it's sent in the body rather than the URL path.
+// OldKey, when set, is the key the same secret was previously encrypted
+// under (e.g. before a rename); the server moves that entry to Key instead
+// of leaving it behind as an orphan RotateKEK keeps rewrapping forever.
+type EncryptSecretDataRequest struct {
+	Key    string            `json:"key"`
+	OldKey string            `json:"old_key,omitempty"`
+	Data   map[string]string `json:"data"`
+}
@@ -0,0 +1,41 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+type SecretProvider struct {
+	ID string `json:"id"`
+
+	Name string                     `json:"name"`
+	Type cstypes.SecretProviderType `json:"type"`
+
+	Vault *cstypes.VaultConfig `json:"vault,omitempty"`
+	AWSSM *cstypes.AWSSMConfig `json:"awssm,omitempty"`
+	GCPSM *cstypes.GCPSMConfig `json:"gcpsm,omitempty"`
+	K8s   *cstypes.K8sConfig   `json:"k8s,omitempty"`
+}
+
+type CreateUpdateSecretProviderRequest struct {
+	Name string                     `json:"name"`
+	Type cstypes.SecretProviderType `json:"type"`
+
+	Vault *cstypes.VaultConfig `json:"vault,omitempty"`
+	AWSSM *cstypes.AWSSMConfig `json:"awssm,omitempty"`
+	GCPSM *cstypes.GCPSMConfig `json:"gcpsm,omitempty"`
+	K8s   *cstypes.K8sConfig   `json:"k8s,omitempty"`
+}
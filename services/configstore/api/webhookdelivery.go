@@ -0,0 +1,145 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+
+	"agola.io/agola/internal/services/configstore/command"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+type ProjectWebhookDeliveriesHandler struct {
+	log zerolog.Logger
+	ch  *command.CommandHandler
+}
+
+func NewProjectWebhookDeliveriesHandler(log zerolog.Logger, ch *command.CommandHandler) *ProjectWebhookDeliveriesHandler {
+	return &ProjectWebhookDeliveriesHandler{log: log, ch: ch}
+}
+
+func (h *ProjectWebhookDeliveriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	projectRef := mux.Vars(r)["projectref"]
+
+	switch r.Method {
+	case http.MethodGet:
+		state := cstypes.WebhookDeliveryState(r.URL.Query().Get("state"))
+		deliveries, err := h.ch.GetProjectWebhookDeliveries(ctx, projectRef, state)
+		if writeError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, deliveries)
+	case http.MethodPost:
+		var delivery cstypes.WebhookDelivery
+		if err := json.NewDecoder(r.Body).Decode(&delivery); err != nil {
+			writeError(w, err)
+			return
+		}
+		created, err := h.ch.CreateProjectWebhookDelivery(ctx, projectRef, &delivery)
+		if writeError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type ProjectWebhookDeliveryHandler struct {
+	log zerolog.Logger
+	ch  *command.CommandHandler
+}
+
+func NewProjectWebhookDeliveryHandler(log zerolog.Logger, ch *command.CommandHandler) *ProjectWebhookDeliveryHandler {
+	return &ProjectWebhookDeliveryHandler{log: log, ch: ch}
+}
+
+func (h *ProjectWebhookDeliveryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vars := mux.Vars(r)
+	projectRef := vars["projectref"]
+	deliveryID := vars["deliveryid"]
+
+	switch r.Method {
+	case http.MethodGet:
+		delivery, err := h.ch.GetProjectWebhookDelivery(ctx, projectRef, deliveryID)
+		if writeError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, delivery)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// WebhookDeliveryHandler updates a delivery (its state/attempts bookkeeping)
+// and lists deliveries ready for a(nother) processing attempt; unlike the
+// other handlers in this file it isn't scoped to a project, since the
+// worker polls across all projects in one request.
+type WebhookDeliveryHandler struct {
+	log zerolog.Logger
+	ch  *command.CommandHandler
+}
+
+func NewWebhookDeliveryHandler(log zerolog.Logger, ch *command.CommandHandler) *WebhookDeliveryHandler {
+	return &WebhookDeliveryHandler{log: log, ch: ch}
+}
+
+func (h *WebhookDeliveryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodPut:
+		var delivery cstypes.WebhookDelivery
+		if err := json.NewDecoder(r.Body).Decode(&delivery); err != nil {
+			writeError(w, err)
+			return
+		}
+		updated, err := h.ch.UpdateWebhookDelivery(ctx, &delivery)
+		if writeError(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, updated)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+type PendingWebhookDeliveriesHandler struct {
+	log zerolog.Logger
+	ch  *command.CommandHandler
+}
+
+func NewPendingWebhookDeliveriesHandler(log zerolog.Logger, ch *command.CommandHandler) *PendingWebhookDeliveriesHandler {
+	return &PendingWebhookDeliveriesHandler{log: log, ch: ch}
+}
+
+func (h *PendingWebhookDeliveriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	deliveries, err := h.ch.GetPendingWebhookDeliveries(r.Context())
+	if writeError(w, err) {
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
@@ -0,0 +1,84 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/sorintlab/errors"
+)
+
+// Client is the gateway's HTTP client for the configstore API. The methods
+// used by the secret provider, trigger rule, webhook delivery and KEK
+// rotation requests live in sibling files in this package; the rest of the
+// configstore API surface that the gateway also calls is assumed to already
+// exist alongside these.
+type Client struct {
+	baseURL string
+	hc      *http.Client
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL: baseURL,
+		hc:      &http.Client{},
+	}
+}
+
+func (c *Client) doJSON(ctx context.Context, method, path string, reqBody, respBody interface{}) (*http.Response, error) {
+	var body bytes.Reader
+	if reqBody != nil {
+		b, err := json.Marshal(reqBody)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to marshal request body")
+		}
+		body = *bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, &body)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "request failed")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.Error == "" {
+			apiErr.Error = fmt.Sprintf("request failed with status %d", resp.StatusCode)
+		}
+		return resp, errors.Errorf("%s", apiErr.Error)
+	}
+
+	if respBody != nil {
+		if err := json.NewDecoder(resp.Body).Decode(respBody); err != nil {
+			return resp, errors.Wrapf(err, "failed to decode response body")
+		}
+	}
+
+	return resp, nil
+}
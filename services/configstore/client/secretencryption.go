@@ -0,0 +1,45 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"net/http"
+
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+// EncryptSecretData envelope-encrypts data server-side and returns the
+// resulting ciphertext, so the caller never has to hold a KMS provider or
+// keep the plaintext around after this returns. key identifies the secret
+// for later RotateKEK purposes (see action.secretEncryptionKey); it can
+// contain "/" so it's sent in the body rather than the URL path. oldKey, if
+// non-empty, is the key the same secret was previously encrypted under (see
+// EncryptSecretDataRequest.OldKey); pass "" when there's nothing to migrate.
+func (c *Client) EncryptSecretData(ctx context.Context, key, oldKey string, data map[string]string) (*cstypes.EncryptedSecretData, *http.Response, error) {
+	reqBody := &csapitypes.EncryptSecretDataRequest{Key: key, OldKey: oldKey, Data: data}
+
+	var enc cstypes.EncryptedSecretData
+	resp, err := c.doJSON(ctx, http.MethodPost, "/api/v1alpha/secrets/encrypt", reqBody, &enc)
+	return &enc, resp, err
+}
+
+// RotateKEK re-wraps every secret's DEK under the KMS provider previously
+// staged server-side, making it the current one.
+func (c *Client) RotateKEK(ctx context.Context) (*http.Response, error) {
+	resp, err := c.doJSON(ctx, http.MethodPost, "/api/v1alpha/kms/rotate", nil, nil)
+	return resp, err
+}
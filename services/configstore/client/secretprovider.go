@@ -0,0 +1,55 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	csapitypes "agola.io/agola/services/configstore/api/types"
+)
+
+func (c *Client) GetSecretProviders(ctx context.Context) ([]*csapitypes.SecretProvider, *http.Response, error) {
+	var sps []*csapitypes.SecretProvider
+	resp, err := c.doJSON(ctx, http.MethodGet, "/api/v1alpha/secretproviders", nil, &sps)
+	return sps, resp, err
+}
+
+// GetSecretProvider fetches a secret provider by its generated ID, the
+// identifier a secret's SecretProviderID refers to (as opposed to the other
+// methods below, which address a provider by its user-assigned Name).
+func (c *Client) GetSecretProvider(ctx context.Context, id string) (*csapitypes.SecretProvider, *http.Response, error) {
+	var sp csapitypes.SecretProvider
+	resp, err := c.doJSON(ctx, http.MethodGet, fmt.Sprintf("/api/v1alpha/secretproviders/%s", id), nil, &sp)
+	return &sp, resp, err
+}
+
+func (c *Client) CreateSecretProvider(ctx context.Context, req *csapitypes.CreateUpdateSecretProviderRequest) (*csapitypes.SecretProvider, *http.Response, error) {
+	var sp csapitypes.SecretProvider
+	resp, err := c.doJSON(ctx, http.MethodPost, "/api/v1alpha/secretproviders", req, &sp)
+	return &sp, resp, err
+}
+
+func (c *Client) UpdateSecretProvider(ctx context.Context, name string, req *csapitypes.CreateUpdateSecretProviderRequest) (*csapitypes.SecretProvider, *http.Response, error) {
+	var sp csapitypes.SecretProvider
+	resp, err := c.doJSON(ctx, http.MethodPut, fmt.Sprintf("/api/v1alpha/secretproviders/%s", name), req, &sp)
+	return &sp, resp, err
+}
+
+func (c *Client) DeleteSecretProvider(ctx context.Context, name string) (*http.Response, error) {
+	resp, err := c.doJSON(ctx, http.MethodDelete, fmt.Sprintf("/api/v1alpha/secretproviders/%s", name), nil, nil)
+	return resp, err
+}
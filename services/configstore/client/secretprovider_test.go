@@ -0,0 +1,99 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+
+	"agola.io/agola/internal/services/configstore/command"
+	csapi "agola.io/agola/services/configstore/api"
+	csapitypes "agola.io/agola/services/configstore/api/types"
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *Client) {
+	t.Helper()
+
+	ch, err := command.NewCommandHandler(nil, "")
+	if err != nil {
+		t.Fatalf("NewCommandHandler() error = %v", err)
+	}
+
+	r := mux.NewRouter()
+	r.Handle("/api/v1alpha/secretproviders", csapi.NewSecretProvidersHandler(zerolog.Logger{}, ch))
+	r.Handle("/api/v1alpha/secretproviders/{name}", csapi.NewSecretProviderHandler(zerolog.Logger{}, ch))
+
+	srv := httptest.NewServer(r)
+	return srv, NewClient(srv.URL)
+}
+
+func TestSecretProviderCRUD(t *testing.T) {
+	srv, c := newTestServer(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	sp, _, err := c.CreateSecretProvider(ctx, &csapitypes.CreateUpdateSecretProviderRequest{
+		Name: "vault-prod",
+		Type: cstypes.SecretProviderTypeVault,
+		Vault: &cstypes.VaultConfig{
+			Addr:      "http://vault:8200",
+			AuthType:  cstypes.VaultAuthTypeAppRole,
+			MountPath: "secret",
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateSecretProvider() error = %v", err)
+	}
+	if sp.Name != "vault-prod" {
+		t.Fatalf("CreateSecretProvider() name = %q, want vault-prod", sp.Name)
+	}
+	if sp.ID == "" {
+		t.Fatalf("CreateSecretProvider() returned empty ID")
+	}
+
+	sps, _, err := c.GetSecretProviders(ctx)
+	if err != nil {
+		t.Fatalf("GetSecretProviders() error = %v", err)
+	}
+	if len(sps) != 1 {
+		t.Fatalf("GetSecretProviders() len = %d, want 1", len(sps))
+	}
+
+	got, _, err := c.GetSecretProvider(ctx, sp.ID)
+	if err != nil {
+		t.Fatalf("GetSecretProvider() error = %v", err)
+	}
+	if got.Name != "vault-prod" {
+		t.Fatalf("GetSecretProvider() name = %q, want vault-prod", got.Name)
+	}
+
+	if _, err := c.DeleteSecretProvider(ctx, "vault-prod"); err != nil {
+		t.Fatalf("DeleteSecretProvider() error = %v", err)
+	}
+
+	sps, _, err = c.GetSecretProviders(ctx)
+	if err != nil {
+		t.Fatalf("GetSecretProviders() error = %v", err)
+	}
+	if len(sps) != 0 {
+		t.Fatalf("GetSecretProviders() after delete len = %d, want 0", len(sps))
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+func (c *Client) GetProjectTriggerRules(ctx context.Context, projectRef string) ([]*cstypes.TriggerRule, *http.Response, error) {
+	var rules []*cstypes.TriggerRule
+	resp, err := c.doJSON(ctx, http.MethodGet, fmt.Sprintf("/api/v1alpha/projects/%s/triggerrules", projectRef), nil, &rules)
+	return rules, resp, err
+}
+
+func (c *Client) CreateProjectTriggerRule(ctx context.Context, projectRef string, rule *cstypes.TriggerRule) (*cstypes.TriggerRule, *http.Response, error) {
+	var created cstypes.TriggerRule
+	resp, err := c.doJSON(ctx, http.MethodPost, fmt.Sprintf("/api/v1alpha/projects/%s/triggerrules", projectRef), rule, &created)
+	return &created, resp, err
+}
+
+func (c *Client) DeleteProjectTriggerRule(ctx context.Context, projectRef, name string) (*http.Response, error) {
+	resp, err := c.doJSON(ctx, http.MethodDelete, fmt.Sprintf("/api/v1alpha/projects/%s/triggerrules/%s", projectRef, name), nil, nil)
+	return resp, err
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	cstypes "agola.io/agola/services/configstore/types"
+)
+
+func (c *Client) CreateProjectWebhookDelivery(ctx context.Context, projectRef string, delivery *cstypes.WebhookDelivery) (*cstypes.WebhookDelivery, *http.Response, error) {
+	var created cstypes.WebhookDelivery
+	resp, err := c.doJSON(ctx, http.MethodPost, fmt.Sprintf("/api/v1alpha/projects/%s/webhookdeliveries", projectRef), delivery, &created)
+	return &created, resp, err
+}
+
+func (c *Client) GetProjectWebhookDeliveries(ctx context.Context, projectRef string, state cstypes.WebhookDeliveryState) ([]*cstypes.WebhookDelivery, *http.Response, error) {
+	path := fmt.Sprintf("/api/v1alpha/projects/%s/webhookdeliveries", projectRef)
+	if state != "" {
+		path += "?state=" + url.QueryEscape(string(state))
+	}
+
+	var deliveries []*cstypes.WebhookDelivery
+	resp, err := c.doJSON(ctx, http.MethodGet, path, nil, &deliveries)
+	return deliveries, resp, err
+}
+
+func (c *Client) GetProjectWebhookDelivery(ctx context.Context, projectRef, deliveryID string) (*cstypes.WebhookDelivery, *http.Response, error) {
+	var delivery cstypes.WebhookDelivery
+	resp, err := c.doJSON(ctx, http.MethodGet, fmt.Sprintf("/api/v1alpha/projects/%s/webhookdeliveries/%s", projectRef, deliveryID), nil, &delivery)
+	return &delivery, resp, err
+}
+
+func (c *Client) UpdateWebhookDelivery(ctx context.Context, delivery *cstypes.WebhookDelivery) (*cstypes.WebhookDelivery, *http.Response, error) {
+	var updated cstypes.WebhookDelivery
+	resp, err := c.doJSON(ctx, http.MethodPut, "/api/v1alpha/webhookdeliveries/"+delivery.ID, delivery, &updated)
+	return &updated, resp, err
+}
+
+// GetPendingWebhookDeliveries returns every delivery, across all projects,
+// that's ready for a(nother) processing attempt. It backs the gateway's
+// webhook delivery worker poll loop.
+func (c *Client) GetPendingWebhookDeliveries(ctx context.Context) ([]*cstypes.WebhookDelivery, *http.Response, error) {
+	var deliveries []*cstypes.WebhookDelivery
+	resp, err := c.doJSON(ctx, http.MethodGet, "/api/v1alpha/webhookdeliveries/pending", nil, &deliveries)
+	return deliveries, resp, err
+}
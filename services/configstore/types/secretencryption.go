@@ -0,0 +1,43 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+// EncryptionAlg identifies the symmetric algorithm used to encrypt a
+// secret's data with its per-secret DEK.
+type EncryptionAlg string
+
+const EncryptionAlgAES256GCM EncryptionAlg = "aes256gcm"
+
+// KMSProviderType identifies which backend wraps/unwraps secret DEKs.
+type KMSProviderType string
+
+const (
+	KMSProviderTypeLocal        KMSProviderType = "local"
+	KMSProviderTypeVaultTransit KMSProviderType = "vaulttransit"
+	KMSProviderTypeAWSKMS       KMSProviderType = "awskms"
+	KMSProviderTypeGCPKMS       KMSProviderType = "gcpkms"
+)
+
+// EncryptedSecretData is how a secret's Data is stored at rest once envelope
+// encryption is enabled: Data itself is encrypted with a per-secret DEK
+// (Ciphertext, under Alg), and the DEK is in turn wrapped by the KEK
+// identified by KEKID so it can only be recovered by going through the KMS
+// provider that owns that KEK.
+type EncryptedSecretData struct {
+	Ciphertext []byte        `json:"ciphertext"`
+	WrappedDEK []byte        `json:"wrapped_dek"`
+	KEKID      string        `json:"kek_id"`
+	Alg        EncryptionAlg `json:"alg"`
+}
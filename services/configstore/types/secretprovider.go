@@ -0,0 +1,88 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+// SecretTypeExternal marks a secret whose data isn't stored in configstore
+// but fetched at run time from the SecretProvider/Path it references.
+const SecretTypeExternal SecretType = "external"
+
+// SecretProviderType identifies which backend a SecretProvider talks to.
+type SecretProviderType string
+
+const (
+	SecretProviderTypeVault SecretProviderType = "vault"
+	SecretProviderTypeAWSSM SecretProviderType = "awssm"
+	SecretProviderTypeGCPSM SecretProviderType = "gcpsm"
+	SecretProviderTypeK8s   SecretProviderType = "k8s"
+)
+
+// VaultAuthType is the authentication method used to log into Vault.
+type VaultAuthType string
+
+const (
+	VaultAuthTypeAppRole    VaultAuthType = "approle"
+	VaultAuthTypeKubernetes VaultAuthType = "kubernetes"
+)
+
+// VaultConfig holds the configuration needed to reach a HashiCorp Vault
+// server and authenticate to it.
+type VaultConfig struct {
+	Addr      string        `json:"addr"`
+	AuthType  VaultAuthType `json:"auth_type"`
+	MountPath string        `json:"mount_path"`
+
+	// AppRole auth
+	RoleID   string `json:"role_id,omitempty"`
+	SecretID string `json:"secret_id,omitempty"`
+
+	// Kubernetes auth
+	KubernetesRole     string `json:"kubernetes_role,omitempty"`
+	KubernetesAuthPath string `json:"kubernetes_auth_path,omitempty"`
+}
+
+// AWSSMConfig holds the configuration needed to reach AWS Secrets Manager.
+// When RoleARN is empty the EC2 instance profile credentials are used.
+type AWSSMConfig struct {
+	Region  string `json:"region"`
+	RoleARN string `json:"role_arn,omitempty"`
+}
+
+// GCPSMConfig holds the configuration needed to reach GCP Secret Manager.
+// When WorkloadIdentityProvider is empty the ambient application default
+// credentials are used.
+type GCPSMConfig struct {
+	ProjectID                string `json:"project_id"`
+	WorkloadIdentityProvider string `json:"workload_identity_provider,omitempty"`
+}
+
+// K8sConfig holds the configuration needed to read a Kubernetes secret from
+// the cluster the executor is running in.
+type K8sConfig struct {
+	Namespace string `json:"namespace"`
+}
+
+// SecretProvider is a named, globally defined external secret backend that
+// project/project group secrets of type external can reference by ID.
+type SecretProvider struct {
+	ID string `json:"id"`
+
+	Name string             `json:"name"`
+	Type SecretProviderType `json:"type"`
+
+	Vault *VaultConfig `json:"vault,omitempty"`
+	AWSSM *AWSSMConfig `json:"awssm,omitempty"`
+	GCPSM *GCPSMConfig `json:"gcpsm,omitempty"`
+	K8s   *K8sConfig   `json:"k8s,omitempty"`
+}
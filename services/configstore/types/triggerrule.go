@@ -0,0 +1,67 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+// EventAdapterType identifies which generic event format a TriggerRule
+// matches against.
+type EventAdapterType string
+
+const (
+	EventAdapterTypeGeneric           EventAdapterType = "generic"
+	EventAdapterTypeDockerRegistry    EventAdapterType = "dockerregistry"
+	EventAdapterTypeContainerRegistry EventAdapterType = "containerregistry"
+	EventAdapterTypeCloudEvents       EventAdapterType = "cloudevents"
+)
+
+// SignatureScheme identifies how a TriggerRule verifies the authenticity of
+// an incoming event, via a header carrying an HMAC or a shared secret.
+type SignatureScheme string
+
+const (
+	SignatureSchemeNone       SignatureScheme = "none"
+	SignatureSchemeHMACSHA256 SignatureScheme = "hmac-sha256"
+	SignatureSchemeSharedKey  SignatureScheme = "sharedkey"
+)
+
+// TriggerRule matches a generic event received on the events endpoint to a
+// project, extracting the ref/commit the run should be created for via
+// JSONPath selectors on the event payload.
+type TriggerRule struct {
+	ID string `json:"id"`
+
+	ProjectID string `json:"project_id"`
+
+	Name        string           `json:"name"`
+	AdapterType EventAdapterType `json:"adapter_type"`
+
+	// SignatureScheme and SignatureHeader describe how to verify the event
+	// came from the expected sender.
+	SignatureScheme SignatureScheme `json:"signature_scheme"`
+	SignatureHeader string          `json:"signature_header"`
+	SignatureSecret string          `json:"signature_secret"`
+
+	// JSONPath selectors used to pick the run ref out of the event payload.
+	// RefJSONPath is required, except for the docker and container registry
+	// adapters, which default the ref to the pushed tag when it's empty; the
+	// rest are optional and default to the
+	// zero value when the payload doesn't have a matching field.
+	RefJSONPath       string `json:"ref_jsonpath"`
+	RefTypeJSONPath   string `json:"ref_type_jsonpath"`
+	CommitSHAJSONPath string `json:"commit_sha_jsonpath"`
+
+	// TemplateVarsJSONPath maps template variable names (usable in the run
+	// config) to a JSONPath selector on the event payload.
+	TemplateVarsJSONPath map[string]string `json:"template_vars_jsonpath"`
+}
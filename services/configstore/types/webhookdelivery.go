@@ -0,0 +1,53 @@
+// Copyright 2019 Sorint.lab
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import "time"
+
+// WebhookDeliveryState is the processing state of a persisted webhook
+// delivery, mirroring the lifecycle of a GitHub webhook redelivery entry.
+type WebhookDeliveryState string
+
+const (
+	// WebhookDeliveryStatePending hasn't been processed yet.
+	WebhookDeliveryStatePending WebhookDeliveryState = "pending"
+	// WebhookDeliveryStateDelivered was processed successfully (a run was
+	// created, or the webhook was legitimately skipped).
+	WebhookDeliveryStateDelivered WebhookDeliveryState = "delivered"
+	// WebhookDeliveryStateFailed errored but has retry attempts left.
+	WebhookDeliveryStateFailed WebhookDeliveryState = "failed"
+	// WebhookDeliveryStateDeadLetter exhausted its retry attempts.
+	WebhookDeliveryStateDeadLetter WebhookDeliveryState = "deadletter"
+)
+
+// WebhookDelivery is the durable record of a single received webhook
+// request, persisted before parsing so a processing failure never loses the
+// delivery. It can be inspected and manually replayed from the gateway API.
+type WebhookDelivery struct {
+	ID string `json:"id"`
+
+	ProjectID string `json:"project_id"`
+
+	Headers map[string][]string `json:"headers"`
+	Body    []byte              `json:"body"`
+
+	ReceivedAt        time.Time `json:"received_at"`
+	SignatureVerified bool      `json:"signature_verified"`
+
+	State       WebhookDeliveryState `json:"state"`
+	Attempts    int                  `json:"attempts"`
+	LastAttempt time.Time            `json:"last_attempt,omitempty"`
+	LastError   string               `json:"last_error,omitempty"`
+}